@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dmlongo/hd-gen/db"
+	"github.com/dmlongo/hd-gen/decomp"
+)
+
+var answerCmd = command{
+	name:     "answer",
+	summary:  "Answer the query of a hypergraph on a database with Yannakakis",
+	required: []string{"db"},
+	flags: func(flagSet *flag.FlagSet) {
+		flagSet.StringVar(&graph, "graph", "", "Hypergraph of the query, whose edges are named as the tables of the database")
+		flagSet.StringVar(&sqlFile, "sql", "", "Select-project-join SQL query to answer instead of -graph")
+		flagSet.StringVar(&datalogFile, "datalog", "", "Conjunctive query written as a Datalog rule to answer instead of -graph")
+		flagSet.StringVar(&dbPath, "db", "", "Database to answer the query on, either a file or a directory of CSV files")
+		csvFlags(flagSet)
+		flagSet.StringVar(&decompFile, "decomp", "", "Decomposition of the query, in gml format (default => search one of the given width)")
+		flagSet.IntVar(&width, "width", 0, "Width of the decomposition to search for if none is given (width > 0)")
+		flagSet.StringVar(&evaldb, "evaldb", "", "Search the cheapest decomposition according to a given database")
+		flagSet.StringVar(&evaljoin, "evaljoin", "", "Search the cheapest decomposition according to given join estimates")
+		flagSet.IntVar(&timeout, "timeout", 0, "Set a timeout in milliseconds for the search of the decomposition")
+		flagSet.IntVar(&workers, "workers", workers, "Number of goroutines decomposing independent components at once")
+		flagSet.BoolVar(&allAnswers, "all", false, "Output all answers as CSV instead of whether one exists")
+	},
+	validate: func() error {
+		if err := validateInput(); err != nil {
+			return err
+		}
+		if decompFile == "" && width <= 0 {
+			return fmt.Errorf("either decomp or width > 0 is required")
+		}
+		if timeout < 0 {
+			return fmt.Errorf("timeout must be >= 0")
+		}
+		if workers < 1 {
+			return fmt.Errorf("workers must be >= 1")
+		}
+		if err := validateCSV(); err != nil {
+			return err
+		}
+		return validateEvaluator(false)
+	},
+	run: runAnswer,
+}
+
+// runAnswer prints the answers on stdout and the time of each phase on stderr
+func runAnswer() {
+	hg, encoding, q := loadInput()
+	var dec Decomp
+	start := time.Now()
+	if decompFile != "" {
+		dec = readDecomp(decompFile, hg, encoding)
+	} else {
+		dec = findDecomp(hg, encoding, loadInputEvaluator(q, hg, encoding))
+	}
+	decompTime := time.Since(start)
+
+	start = time.Now()
+	data := loadDB(dbPath)
+	var e2t map[int]string
+	if q != nil {
+		var err error
+		if data, e2t, err = q.Bind(data); err != nil {
+			fmt.Fprintln(os.Stderr, "Can't answer the query:", err)
+			os.Exit(1)
+		}
+	} else {
+		data, e2t = edgesToTables(hg, encoding, data)
+	}
+	loadTime := time.Since(start)
+
+	y := decomp.MakeYannakakis(decomp.MakeSearchTree(dec), e2t, data)
+	if !allAnswers {
+		fmt.Println(y.BoolAnswer())
+	} else {
+		w := csv.NewWriter(os.Stdout)
+		ans := y.AllAnswers()
+		if q != nil {
+			w.Write(q.Header)
+			for _, tup := range q.Answers(ans) {
+				w.Write(tup.Strings())
+			}
+		} else if ans != nil {
+			w.Write(ans.Attributes())
+			for i := 0; i < ans.Size(); i++ {
+				w.Write(ans.Tuple(i).Strings())
+			}
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			panic(err)
+		}
+	}
+
+	phases := y.Phases()
+	fmt.Fprintf(os.Stderr, "Decomposition: %.3f ms\n", millis(decompTime))
+	fmt.Fprintf(os.Stderr, "Loading: %.3f ms\n", millis(loadTime))
+	fmt.Fprintf(os.Stderr, "Node joins: %.3f ms\n", millis(phases.NodeJoins))
+	for _, j := range y.Joins() {
+		sizes := make([]string, len(j.Inputs))
+		for i, n := range j.Inputs {
+			sizes[i] = strconv.Itoa(n)
+		}
+		fmt.Fprintf(os.Stderr, "  %v join of %v tuples\n", j.Algorithm, strings.Join(sizes, " x "))
+	}
+	fmt.Fprintf(os.Stderr, "Bottom-up reduce: %.3f ms\n", millis(phases.BottomUp))
+	if allAnswers {
+		fmt.Fprintf(os.Stderr, "Top-down reduce: %.3f ms\n", millis(phases.TopDown))
+		fmt.Fprintf(os.Stderr, "Join-up: %.3f ms\n", millis(phases.JoinUp))
+	}
+}
+
+// findDecomp searches the first decomposition of hg of the given width,
+// or the cheapest one if an evaluator is given. If the timeout expires
+// first, it settles for the cheapest one found so far.
+func findDecomp(hg Graph, encoding map[string]int, ev *decomp.Evaluator) Decomp {
+	searchMode, limit := "enum", 1
+	if ev != nil {
+		searchMode, limit = "best", 0 // best sends every improvement, keep the last
+	}
+	solver := newSolver(searchMode, width, hg, ev)
+
+	ctx, cancel := withTimeout(timeout)
+	defer cancel()
+	var res Decomp
+	found := false
+	status, err := search(ctx, solver, limit, func(dec Decomp) {
+		res, found = dec, true
+	})
+	switch {
+	case status == statusError:
+		fmt.Fprintln(os.Stderr, "Search failed:", err)
+		os.Exit(1)
+	case status == statusTimeout && !found:
+		fmt.Fprintln(os.Stderr, "No decomposition was found within the timeout of", timeout, "ms")
+		os.Exit(exitTimeout)
+	case status == statusTimeout:
+		fmt.Fprintln(os.Stderr, "Using the cheapest decomposition found within the timeout of", timeout, "ms")
+	case !found:
+		fmt.Fprintln(os.Stderr, "No decomposition of width", width, "exists")
+		os.Exit(1)
+	}
+	return res
+}
+
+// edgesToTables maps each edge of hg to the table named as the edge, with its
+// columns renamed after the vertices of the edge, so that the tables join on
+// the vertices of hg. Tables are found by the names of the edges, so an atom
+// cannot use the relation of another one, unless the query is given with -sql
+// or -datalog.
+func edgesToTables(hg Graph, encoding map[string]int, data db.Database) (db.Database, map[int]string) {
+	vNames := decomp.Names(encoding)
+	res := make(db.Database)
+	e2t := make(map[int]string)
+	for _, e := range hg.Edges.Slice() {
+		tName := vNames[e.Name]
+		tab, ok := data[tName]
+		if !ok {
+			panic(fmt.Errorf("no table for edge %v", tName))
+		}
+		if len(tab.Attributes()) != len(e.Vertices) {
+			panic(fmt.Errorf("table %v has %v columns, its edge has %v vertices", tName, len(tab.Attributes()), len(e.Vertices)))
+		}
+		attrs := make([]string, len(e.Vertices))
+		for i, v := range e.Vertices {
+			attrs[i] = vNames[v]
+		}
+		res[tName] = tab.Rename(attrs)
+		e2t[e.Name] = tName
+	}
+	return res, e2t
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cem-okulmus/BalancedGo/lib"
+	"github.com/dmlongo/hd-gen/decomp"
+)
+
+var batchHeader = []string{"instance", "k", "decomps", "first_ms", "total_ms", "best_cost", "status"}
+
+type batchRow struct {
+	instance string
+	k        int
+	decomps  int
+	first    time.Duration // < 0 if no decomposition was found
+	total    time.Duration
+	bestCost int // < 0 if no decomposition was evaluated
+	status   string
+}
+
+func (r batchRow) record() []string {
+	first, bestCost := "", ""
+	if r.first >= 0 {
+		first = strconv.FormatFloat(millis(r.first), 'f', 3, 64)
+	}
+	if r.bestCost >= 0 {
+		bestCost = strconv.Itoa(r.bestCost)
+	}
+	return []string{r.instance, strconv.Itoa(r.k), strconv.Itoa(r.decomps), first,
+		strconv.FormatFloat(millis(r.total), 'f', 3, 64), bestCost, r.status}
+}
+
+type batchConfig struct {
+	graphs   string
+	minWidth int
+	maxWidth int
+	mode     string
+	enum     int
+	complete bool
+	evaldb   string
+	evaljoin string
+	timeout  int
+	out      string
+}
+
+var batchCfg batchConfig
+var widths string
+
+var batchCmd = command{
+	name:     "batch",
+	summary:  "Decompose many hypergraphs and summarize the searches in a CSV file",
+	required: []string{"graphs", "width"},
+	flags: func(flagSet *flag.FlagSet) {
+		flagSet.StringVar(&batchCfg.graphs, "graphs", "", "Directory or glob pattern of the hypergraphs to decompose")
+		flagSet.StringVar(&widths, "width", "", "Width, or range of widths min-max, to search for (width > 0)")
+		flagSet.StringVar(&batchCfg.mode, "mode", "enum", "Mode of the generator (enum, best, bnb, rank, opt)")
+		flagSet.IntVar(&batchCfg.enum, "enum", 0, "Number of decompositions to search for each instance (default => all)")
+		flagSet.BoolVar(&batchCfg.complete, "complete", false, "Forces the computation of complete decompositions")
+		flagSet.StringVar(&batchCfg.evaldb, "evaldb", "", "Directory of databases named after the instances they evaluate, as name.csv or a directory name of CSV files")
+		flagSet.StringVar(&batchCfg.evaljoin, "evaljoin", "", "Directory of join estimates named after the instances they evaluate, as name.csv")
+		flagSet.IntVar(&batchCfg.timeout, "timeout", 0, "Set a timeout in milliseconds for each instance and width")
+		flagSet.IntVar(&workers, "workers", workers, "Number of goroutines decomposing independent components at once (enum and best modes)")
+		flagSet.StringVar(&batchCfg.out, "out", "", "Write the summary CSV into the specified file (default => stdout)")
+	},
+	validate: func() error {
+		var err error
+		if batchCfg.minWidth, batchCfg.maxWidth, err = parseWidths(widths); err != nil {
+			return err
+		}
+		if batchCfg.enum < 0 {
+			return fmt.Errorf("enum must be >= 0")
+		}
+		if batchCfg.timeout < 0 {
+			return fmt.Errorf("timeout must be >= 0")
+		}
+		if workers < 1 {
+			return fmt.Errorf("workers must be >= 1")
+		}
+		if batchCfg.mode != "enum" && batchCfg.mode != "best" && batchCfg.mode != "bnb" && batchCfg.mode != "rank" && batchCfg.mode != "opt" {
+			return fmt.Errorf("mode %v unknown, choose between enum, best, bnb, rank, opt", batchCfg.mode)
+		}
+		if batchCfg.evaldb != "" && batchCfg.evaljoin != "" {
+			return fmt.Errorf("choose only one between evaldb and evaljoin")
+		}
+		if (batchCfg.mode == "best" || batchCfg.mode == "bnb" || batchCfg.mode == "rank" || batchCfg.mode == "opt") && (batchCfg.evaldb == "" && batchCfg.evaljoin == "") {
+			return fmt.Errorf("mode %v requires either evaldb or evaljoin", batchCfg.mode)
+		}
+		return nil
+	},
+	run: runBatch,
+}
+
+func runBatch() {
+	cfg := batchCfg
+	instances, err := listInstances(cfg.graphs)
+	if err != nil {
+		panic(err)
+	}
+
+	var w io.Writer = os.Stdout
+	if cfg.out != "" {
+		f, err := os.Create(cfg.out)
+		if err != nil {
+			panic(err)
+		}
+		defer f.Close()
+		w = f
+	}
+	csvOut := csv.NewWriter(w)
+	csvOut.Write(batchHeader)
+	csvOut.Flush()
+
+	for _, path := range instances {
+		for _, row := range batchInstance(path, cfg) {
+			csvOut.Write(row.record())
+			csvOut.Flush() // keep the summary of finished instances if the batch is killed
+			fmt.Fprintln(os.Stderr, row.instance, "K =", row.k, "=>", row.status)
+		}
+	}
+	if err := csvOut.Error(); err != nil {
+		panic(err)
+	}
+}
+
+// parseWidths reads either a single width or a range min-max
+func parseWidths(s string) (int, int, error) {
+	bounds := strings.SplitN(s, "-", 2)
+	min, err := strconv.Atoi(bounds[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("width %q is not valid", s)
+	}
+	max := min
+	if len(bounds) == 2 {
+		if max, err = strconv.Atoi(bounds[1]); err != nil {
+			return 0, 0, fmt.Errorf("width %q is not valid", s)
+		}
+	}
+	if min <= 0 || max < min {
+		return 0, 0, fmt.Errorf("width %q is not a valid range", s)
+	}
+	return min, max, nil
+}
+
+// listInstances returns the files in a directory, or the files matching a glob pattern
+func listInstances(graphs string) ([]string, error) {
+	var res []string
+	if info, err := os.Stat(graphs); err == nil && info.IsDir() {
+		files, err := ioutil.ReadDir(graphs)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			if !f.IsDir() {
+				res = append(res, filepath.Join(graphs, f.Name()))
+			}
+		}
+	} else {
+		matches, err := filepath.Glob(graphs)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range matches {
+			if info, err := os.Stat(m); err == nil && !info.IsDir() {
+				res = append(res, m)
+			}
+		}
+	}
+	if len(res) == 0 {
+		return nil, fmt.Errorf("no hypergraph found in %v", graphs)
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+// companion finds the file in dir named as instance with extension ext, or
+// without extension, such as a directory of CSV files
+func companion(dir string, instance string, ext string) string {
+	if dir == "" {
+		return ""
+	}
+	base := filepath.Base(instance)
+	name := strings.TrimSuffix(base, filepath.Ext(base))
+	for _, path := range []string{filepath.Join(dir, name+ext), filepath.Join(dir, name)} {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	panic(fmt.Errorf("no statistics for %v in %v", base, dir))
+}
+
+// batchInstance searches the decompositions of one instance for every width.
+// Failures are reported in the status of the rows and never propagated.
+func batchInstance(path string, cfg batchConfig) []batchRow {
+	var rows []batchRow
+	for k := cfg.minWidth; k <= cfg.maxWidth; k++ {
+		rows = append(rows, batchRow{instance: filepath.Base(path), k: k, first: -1, bestCost: -1, status: statusError})
+	}
+
+	hg, ev, err := loadInstance(path, cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, filepath.Base(path), "failed:", err)
+		return rows
+	}
+
+	for i := range rows {
+		batchRun(&rows[i], hg, ev, cfg)
+	}
+	return rows
+}
+
+// loadInstance parses a hypergraph and its evaluator, recovering from parse errors
+func loadInstance(path string, cfg batchConfig) (hg Graph, ev *decomp.Evaluator, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	dat, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Graph{}, nil, err
+	}
+	hg, parsedGraph := lib.GetGraph(string(dat))
+	ev = loadEvaluator(companion(cfg.evaldb, path, ".csv"), companion(cfg.evaljoin, path, ".csv"), hg, parsedGraph.Encoding)
+	return hg, ev, nil
+}
+
+func batchRun(row *batchRow, originalGraph Graph, ev *decomp.Evaluator, cfg batchConfig) {
+	start := time.Now()
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Fprintln(os.Stderr, row.instance, "K =", row.k, "failed:", r)
+			row.status = statusError
+		}
+		row.total = time.Since(start)
+	}()
+
+	hg := originalGraph
+	var addedVertices []int
+	if cfg.complete {
+		addedVertices = hg.MakeEdgesDistinct()
+	}
+	solver := newSolver(cfg.mode, row.k, hg, ev)
+
+	ctx, cancel := withTimeout(cfg.timeout)
+	defer cancel()
+	status, err := search(ctx, solver, cfg.enum, func(dec Decomp) {
+		if row.decomps == 0 {
+			row.first = time.Since(start)
+		}
+		row.decomps++
+		if ev != nil {
+			if cfg.complete {
+				dec.Root.RemoveVertices(addedVertices)
+			}
+			dec.Graph = originalGraph
+			if cost := ev.Eval(dec); row.bestCost < 0 || cost < row.bestCost {
+				row.bestCost = cost
+			}
+		}
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, row.instance, "K =", row.k, "failed:", err)
+	}
+	row.status = status
+}
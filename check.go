@@ -0,0 +1,29 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+var checkCmd = command{
+	name:     "check",
+	summary:  "Validate an existing decomposition against its hypergraph",
+	required: []string{"graph", "decomp"},
+	flags: func(flagSet *flag.FlagSet) {
+		flagSet.StringVar(&graph, "graph", "", "Hypergraph of the decomposition (for format see hyperbench.dbai.tuwien.ac.at/downloads/manual.pdf)")
+		flagSet.StringVar(&decompFile, "decomp", "", "Decomposition to validate, in gml format")
+	},
+	run: runCheck,
+}
+
+func runCheck() {
+	hg, parsedGraph := loadGraph(graph)
+	dec := readDecomp(decompFile, hg, parsedGraph.Encoding)
+	correct := dec.Correct(hg)
+	fmt.Println("Width: ", dec.CheckWidth())
+	fmt.Println("Correct: ", correct)
+	if !correct {
+		os.Exit(1)
+	}
+}
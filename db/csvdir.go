@@ -0,0 +1,149 @@
+package db
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CSVOptions configure how LoadDir reads the files of the tables
+type CSVOptions struct {
+	Comma rune   // separator of the fields
+	Quote rune   // encloses fields with separators, quotes or newlines, none if 0
+	Null  string // marker of missing values, none if empty
+	Ext   string // extension of the files of the tables
+}
+
+// DefaultCSV reads the .csv files of RFC 4180, without missing values
+var DefaultCSV = CSVOptions{Comma: ',', Quote: '"', Ext: ".csv"}
+
+// LoadDir reads a database with a table for each file of dir with the extension
+// of opts, named after the file without the extension. The header of a file
+// gives the attributes of its table, declaring their types as in Load.
+// Files are read one record at a time, so they are never fully in memory.
+func LoadDir(dir string, opts CSVOptions) Database {
+	if opts.Comma == 0 || opts.Comma == opts.Quote || opts.Comma == '\n' || opts.Quote == '\n' {
+		panic(fmt.Errorf("%q and %q are not a valid separator and quote", opts.Comma, opts.Quote))
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		panic(fmt.Errorf("can't open %v: %v", dir, err))
+	}
+
+	db := make(Database)
+	dict := NewDict()
+	for _, f := range files {
+		if f.IsDir() || filepath.Ext(f.Name()) != opts.Ext {
+			continue
+		}
+		name := strings.TrimSuffix(f.Name(), opts.Ext)
+		db[name] = loadCSV(filepath.Join(dir, f.Name()), opts, dict)
+	}
+	return db
+}
+
+func loadCSV(path string, opts CSVOptions, dict *Dict) *Table {
+	file, err := os.Open(path)
+	if err != nil {
+		panic(fmt.Errorf("can't open %v: %v", path, err))
+	}
+	defer file.Close()
+
+	r := &csvReader{in: bufio.NewReader(file), comma: opts.Comma, quote: opts.Quote}
+	header, err := r.read()
+	if err == io.EOF {
+		panic(fmt.Errorf("%v has no header", path))
+	} else if err != nil {
+		panic(fmt.Errorf("%v:%v: %v", path, r.line, err))
+	}
+	attrs, types := parseAttrs(header)
+	t := newTable(attrs, types, dict, true)
+	for {
+		record, err := r.read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			panic(fmt.Errorf("%v:%v: %v", path, r.line, err))
+		}
+		tup, err := t.parseTuple(record, opts.Null)
+		if err != nil {
+			panic(fmt.Errorf("%v:%v: %v", path, r.line, err))
+		}
+		t.AddTuple(tup)
+	}
+	return t
+}
+
+// csvReader splits records in fields, with a configurable separator and quote
+type csvReader struct {
+	in    *bufio.Reader
+	comma rune
+	quote rune
+	line  int
+
+	fields []string
+	field  strings.Builder
+}
+
+// read returns the fields of the next record, which are valid until the next read
+func (r *csvReader) read() ([]string, error) {
+	r.fields = r.fields[:0]
+	r.field.Reset()
+	r.line++
+	quoted, inQuotes, empty := false, false, true
+	for {
+		c, _, err := r.in.ReadRune()
+		if err == io.EOF {
+			if inQuotes {
+				return nil, fmt.Errorf("unterminated quote")
+			}
+			if empty {
+				return nil, io.EOF
+			}
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		empty = false
+
+		switch {
+		case inQuotes && c == r.quote:
+			if next, _, err := r.in.ReadRune(); err == nil && next == r.quote {
+				r.field.WriteRune(c) // an escaped quote
+			} else {
+				if err == nil {
+					r.in.UnreadRune()
+				}
+				inQuotes = false
+			}
+		case inQuotes:
+			if c == '\n' {
+				r.line++
+			}
+			r.field.WriteRune(c)
+		case c == r.quote && r.quote != 0 && r.field.Len() == 0 && !quoted:
+			quoted, inQuotes = true, true
+		case c == r.comma:
+			r.fields = append(r.fields, r.field.String())
+			r.field.Reset()
+			quoted = false
+		case c == '\n' && len(r.fields) == 0 && !quoted && strings.TrimSuffix(r.field.String(), "\r") == "":
+			r.field.Reset() // skip empty lines
+			r.line++
+			empty = true
+		case c == '\n':
+			r.fields = append(r.fields, strings.TrimSuffix(r.field.String(), "\r"))
+			return r.fields, nil
+		case quoted && c != '\r':
+			return nil, fmt.Errorf("%q after a quoted field", c)
+		default:
+			r.field.WriteRune(c)
+		}
+	}
+	r.fields = append(r.fields, strings.TrimSuffix(r.field.String(), "\r"))
+	return r.fields, nil
+}
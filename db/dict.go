@@ -0,0 +1,65 @@
+package db
+
+import "sync"
+
+// Dict encodes values as integers, so that equal values have equal codes.
+// The tables of a database share a dictionary, which lets the operators
+// compare codes instead of values.
+type Dict struct {
+	mu     sync.RWMutex
+	codes  map[Value]uint32
+	values []Value
+}
+
+// nullCode is the code of Null in every dictionary
+const nullCode = 0
+
+func NewDict() *Dict {
+	return &Dict{codes: map[Value]uint32{Null: nullCode}, values: []Value{Null}}
+}
+
+// Encode returns the code of v, adding v to the dictionary if needed
+func (d *Dict) Encode(v Value) uint32 {
+	d.mu.RLock()
+	c, ok := d.codes[v]
+	d.mu.RUnlock()
+	if ok {
+		return c
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if c, ok := d.codes[v]; ok {
+		return c
+	}
+	c = uint32(len(d.values))
+	d.codes[v] = c
+	d.values = append(d.values, v)
+	return c
+}
+
+// Code returns the code of v, false if v is not in the dictionary
+func (d *Dict) Code(v Value) (uint32, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	c, ok := d.codes[v]
+	return c, ok
+}
+
+// Value returns the value of code c
+func (d *Dict) Value(c uint32) Value {
+	return d.snapshot()[c]
+}
+
+func (d *Dict) Len() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return len(d.values)
+}
+
+// snapshot returns the values encoded so far, which can be read without
+// locking, since Encode only appends new values
+func (d *Dict) snapshot() []Value {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.values
+}
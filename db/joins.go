@@ -0,0 +1,313 @@
+package db
+
+import (
+	"math"
+	"sort"
+)
+
+// JoinAlgorithm is an implementation of the join of two tables
+type JoinAlgorithm string
+
+const (
+	NestedLoop JoinAlgorithm = "nested-loop"
+	Hash       JoinAlgorithm = "hash"
+	SortMerge  JoinAlgorithm = "sort-merge"
+	Generic    JoinAlgorithm = "generic"
+)
+
+// hashLimit is the size of the smaller input above which hashing gets
+// expensive, because the hash table no longer fits comfortably in memory
+const hashLimit = 1 << 22
+
+// JoinWith joins l and r with the given algorithm. All of them put the
+// attributes of the larger input first, as Join does.
+func JoinWith(alg JoinAlgorithm, l Table, r Table) *Table {
+	switch alg {
+	case NestedLoop:
+		return NestedLoopJoin(l, r)
+	case Hash:
+		return Join(l, r)
+	case SortMerge:
+		return SortMergeJoin(l, r)
+	default:
+		panic("join algorithm " + string(alg) + " unknown")
+	}
+}
+
+// ChooseJoin picks the cheapest algorithm to join l and r, according to their
+// sizes, whether they are sorted on the join attributes and their statistics
+func ChooseJoin(l *Table, r *Table) JoinAlgorithm {
+	joinIdx := commonAttrs(*l, *r)
+	if len(joinIdx) == 0 {
+		return NestedLoop // a cross product, nothing to match
+	}
+	lPos, rPos := splitIndex(joinIdx)
+	lSize, rSize := float64(l.Size()), float64(r.Size())
+	out := estimateJoinSize(l, r)
+
+	nestedLoop := lSize * rSize
+	hash := 2*(lSize+rSize) + out
+	if math.Min(lSize, rSize) > hashLimit {
+		hash *= 4
+	}
+	sortMerge := sortCost(l, lPos) + sortCost(r, rPos) + lSize + rSize + out
+
+	switch {
+	case nestedLoop <= hash && nestedLoop <= sortMerge:
+		return NestedLoop
+	case hash <= sortMerge:
+		return Hash
+	default:
+		return SortMerge
+	}
+}
+
+// estimateJoinSize divides the cross product by the largest ndv of each join
+// attribute, assuming keys on the larger input if the statistics are missing
+func estimateJoinSize(l *Table, r *Table) float64 {
+	if l.Stats == nil || r.Stats == nil {
+		return math.Max(float64(l.Size()), float64(r.Size()))
+	}
+	out := float64(l.Size()) * float64(r.Size())
+	for _, z := range commonAttrs(*l, *r) {
+		ndv := math.Max(float64(l.Stats.Ndv[z[0]]), float64(r.Stats.Ndv[z[1]]))
+		if ndv > 1 {
+			out /= ndv
+		}
+	}
+	return out
+}
+
+func sortCost(t *Table, pos []int) float64 {
+	n := float64(t.Size())
+	if n < 2 || t.sortedOn(t.dict.snapshot(), pos) {
+		return 0
+	}
+	return n * math.Log2(n)
+}
+
+// NestedLoopJoin compares every pair of tuples of l and r
+func NestedLoopJoin(l Table, r Table) *Table {
+	if l.Size() < r.Size() {
+		l, r = r, l
+	}
+	r = *r.in(l.dict)
+	joinIdx := commonAttrs(l, r)
+	newAttrs, _ := JoinAttrs(&l, &r)
+	newTab := newJoinedTable(newAttrs, &l, &r)
+	rest := restPos(newAttrs, &l, &r)
+	for i := 0; i < l.Size(); i++ {
+		for j := 0; j < r.Size(); j++ {
+			if match(&l, i, &r, j, joinIdx) {
+				joinedTuple(newTab, &l, i, &r, j, rest)
+			}
+		}
+	}
+	return newTab
+}
+
+// SortMergeJoin sorts l and r on the join attributes, unless they already
+// are, and merges the groups of tuples with equal values
+func SortMergeJoin(l Table, r Table) *Table {
+	if l.Size() < r.Size() {
+		l, r = r, l
+	}
+	r = *r.in(l.dict)
+	lPos, rPos := splitIndex(commonAttrs(l, r))
+	newAttrs, _ := JoinAttrs(&l, &r)
+	newTab := newJoinedTable(newAttrs, &l, &r)
+	rest := restPos(newAttrs, &l, &r)
+
+	values := l.dict.snapshot()
+	lOrd, rOrd := l.nonNull(l.sortedOrder(values, lPos), lPos), r.nonNull(r.sortedOrder(values, rPos), rPos)
+	i, j := 0, 0
+	for i < len(lOrd) && j < len(rOrd) {
+		c := compareOn(values, &l, lOrd[i], lPos, &r, rOrd[j], rPos)
+		if c < 0 {
+			i++
+		} else if c > 0 {
+			j++
+		} else {
+			iEnd, jEnd := i+1, j+1
+			for iEnd < len(lOrd) && compareOn(values, &l, lOrd[iEnd], lPos, &l, lOrd[i], lPos) == 0 {
+				iEnd++
+			}
+			for jEnd < len(rOrd) && compareOn(values, &r, rOrd[jEnd], rPos, &r, rOrd[j], rPos) == 0 {
+				jEnd++
+			}
+			for _, a := range lOrd[i:iEnd] {
+				for _, b := range rOrd[j:jEnd] {
+					joinedTuple(newTab, &l, a, &r, b, rest)
+				}
+			}
+			i, j = iEnd, jEnd
+		}
+	}
+	return newTab
+}
+
+// sortedOrder returns the indices of the tuples of t in the order of their values at pos
+func (t *Table) sortedOrder(values []Value, pos []int) []int {
+	ord := make([]int, t.Size())
+	for i := range ord {
+		ord[i] = i
+	}
+	if !t.sortedOn(values, pos) {
+		sort.SliceStable(ord, func(i, j int) bool {
+			return compareOn(values, t, ord[i], pos, t, ord[j], pos) < 0
+		})
+	}
+	return ord
+}
+
+// nonNull removes from ord the tuples with a Null at pos, which match nothing
+func (t *Table) nonNull(ord []int, pos []int) []int {
+	res := ord[:0]
+	for _, i := range ord {
+		if !t.hasNull(i, pos) {
+			res = append(res, i)
+		}
+	}
+	return res
+}
+
+func (t *Table) sortedOn(values []Value, pos []int) bool {
+	for i := 1; i < t.Size(); i++ {
+		if compareOn(values, t, i-1, pos, t, i, pos) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// compareOn compares the i-th tuple of l and the j-th tuple of r, decoding
+// their values only if their codes differ
+func compareOn(values []Value, l *Table, i int, lPos []int, r *Table, j int, rPos []int) int {
+	for k := range lPos {
+		a, b := l.cols[lPos[k]][i], r.cols[rPos[k]][j]
+		if a == b {
+			continue
+		}
+		if c := Compare(values[a], values[b]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// GenericJoin joins all the tables at once, binding one attribute at a time to
+// the values shared by every table that has it. Unlike a sequence of binary
+// joins, it never computes more tuples than the AGM bound of the tables.
+// The attributes of the result are in order of appearance in the tables.
+func GenericJoin(tables ...*Table) *Table {
+	if len(tables) == 0 {
+		panic("no table to join")
+	}
+	tables = append([]*Table(nil), tables...)
+	for i, t := range tables[1:] {
+		tables[i+1] = t.in(tables[0].dict)
+	}
+	var attrs []string
+	seen := make(map[string]bool)
+	for _, t := range tables {
+		for _, a := range t.attrs {
+			if !seen[a] {
+				seen[a] = true
+				attrs = append(attrs, a)
+			}
+		}
+	}
+
+	tries := make([]*trie, len(tables))
+	for i, t := range tables {
+		tries[i] = newTrie(t, attrs, tables)
+	}
+	// the tables that have each attribute, in the order of their tries
+	having := make([][]int, len(attrs))
+	for i, a := range attrs {
+		for j, t := range tables {
+			if _, ok := t.attrPos[a]; ok {
+				having[i] = append(having[i], j)
+			}
+		}
+	}
+
+	newTab := newJoinedTable(attrs, tables...)
+	tup := make([]uint32, len(attrs))
+	var bind func(i int)
+	bind = func(i int) {
+		if i == len(attrs) {
+			for k, c := range tup {
+				newTab.cols[k] = append(newTab.cols[k], c)
+			}
+			return
+		}
+		smallest := having[i][0]
+		for _, j := range having[i][1:] {
+			if len(tries[j].keys) < len(tries[smallest].keys) {
+				smallest = j
+			}
+		}
+	values:
+		for _, val := range tries[smallest].keys {
+			for _, j := range having[i] {
+				if _, ok := tries[j].next[val]; !ok {
+					continue values
+				}
+			}
+			saved := make([]*trie, len(having[i]))
+			for k, j := range having[i] {
+				saved[k] = tries[j]
+				tries[j] = tries[j].next[val]
+			}
+			tup[i] = val
+			bind(i + 1)
+			for k, j := range having[i] {
+				tries[j] = saved[k]
+			}
+		}
+	}
+	bind(0)
+	return newTab
+}
+
+// trie indexes the tuples of a table by their codes, one level per attribute
+type trie struct {
+	keys []uint32 // in order of appearance, so that the result is deterministic
+	next map[uint32]*trie
+}
+
+// newTrie builds the trie of t with its attributes in the order of attrs,
+// without the tuples that have a Null in an attribute joined with another table
+func newTrie(t *Table, attrs []string, tables []*Table) *trie {
+	var pos, joined []int
+	for _, a := range attrs {
+		if p, ok := t.attrPos[a]; ok {
+			pos = append(pos, p)
+			for _, o := range tables {
+				if _, ok := o.attrPos[a]; ok && o != t {
+					joined = append(joined, p)
+					break
+				}
+			}
+		}
+	}
+	root := &trie{next: make(map[uint32]*trie)}
+	for i := 0; i < t.Size(); i++ {
+		if t.hasNull(i, joined) {
+			continue
+		}
+		curr := root
+		for _, p := range pos {
+			c := t.cols[p][i]
+			child, ok := curr.next[c]
+			if !ok {
+				child = &trie{next: make(map[uint32]*trie)}
+				curr.keys = append(curr.keys, c)
+				curr.next[c] = child
+			}
+			curr = child
+		}
+	}
+	return root
+}
@@ -4,11 +4,14 @@ import (
 	"container/heap"
 	"fmt"
 	"math"
+	"sort"
+	"strconv"
 )
 
-type Histogram map[string]int
+// Histogram counts the occurrences of the codes of the values of an attribute
+type Histogram map[uint32]int
 
-func (hgram Histogram) Update(val string, freq int) bool {
+func (hgram Histogram) Update(val uint32, freq int) bool {
 	var ok bool
 	if _, ok = hgram[val]; !ok {
 		hgram[val] = 0
@@ -17,7 +20,7 @@ func (hgram Histogram) Update(val string, freq int) bool {
 	return !ok
 }
 
-func (hgram Histogram) Frequency(val string) int {
+func (hgram Histogram) Frequency(val uint32) int {
 	if freq, ok := hgram[val]; ok {
 		return freq
 	}
@@ -63,16 +66,83 @@ func NewStatistics(attrs []string) *Statistics {
 	return &stats
 }
 
+// withAttrs returns a copy of s whose attributes are renamed to attrs, by position
+func (s *Statistics) withAttrs(attrs []string) *Statistics {
+	res := NewStatistics(attrs)
+	res.Size = s.Size
+	copy(res.Ndv, s.Ndv)
+	for i, h := range s.Hgrams {
+		for c, freq := range h {
+			res.Hgrams[i][c] = freq
+		}
+	}
+	return res
+}
+
 func (s *Statistics) Attributes() []string {
 	return s.attrs
 }
 
+// Key encodes s so that only equal statistics have equal keys
+func (s *Statistics) Key() string {
+	b := strconv.AppendInt(nil, int64(s.Size), 10)
+	for i, attr := range s.attrs {
+		b = append(b, ';')
+		b = strconv.AppendQuote(b, attr)
+		b = append(b, ':')
+		b = strconv.AppendInt(b, int64(s.Ndv[i]), 10)
+		codes := make([]int, 0, len(s.Hgrams[i]))
+		for c := range s.Hgrams[i] {
+			codes = append(codes, int(c))
+		}
+		sort.Ints(codes)
+		for _, c := range codes {
+			b = append(b, ',')
+			b = strconv.AppendInt(b, int64(c), 10)
+			b = append(b, '=')
+			b = strconv.AppendInt(b, int64(s.Hgrams[i][uint32(c)]), 10)
+		}
+	}
+	return string(b)
+}
+
+// ReducerKey encodes what EstimateSemijoinSize reads of s as its right side,
+// if only the attributes in shared can be common with the left side: whether s
+// is empty or uses histograms, and the ndv and the codes in the histogram of
+// each shared attribute, but not their frequencies. Statistics with the same
+// ReducerKey reduce every such left side alike.
+func (s *Statistics) ReducerKey(shared func(attr string) bool) string {
+	b := strconv.AppendBool(nil, s.Size == 0)
+	b = strconv.AppendBool(append(b, ';'), s.usesHistograms())
+	for i, attr := range s.attrs {
+		if !shared(attr) {
+			continue
+		}
+		b = append(b, ';')
+		b = strconv.AppendQuote(b, attr)
+		b = append(b, ':')
+		b = strconv.AppendInt(b, int64(s.Ndv[i]), 10)
+		codes := make([]int, 0, len(s.Hgrams[i]))
+		for c, freq := range s.Hgrams[i] {
+			if freq > 0 {
+				codes = append(codes, int(c))
+			}
+		}
+		sort.Ints(codes)
+		for _, c := range codes {
+			b = append(b, ',')
+			b = strconv.AppendInt(b, int64(c), 10)
+		}
+	}
+	return string(b)
+}
+
 func (s *Statistics) Position(attr string) (pos int, ok bool) {
 	pos, ok = s.attrPos[attr]
 	return
 }
 
-func (s *Statistics) AddTuple(vals []string) {
+func (s *Statistics) AddTuple(vals []uint32) {
 	s.Size++
 	for i, v := range vals {
 		if s.Hgrams[i].Update(v, 1) {
@@ -109,8 +179,14 @@ func (s *Statistics) GetNdv(attr string) int {
 	return s.Ndv[p]
 }
 
-func (s *Statistics) usesHistograms() bool { // todo column as input
-	return s.Size == s.Hgrams[0].Sum() // rough way
+// usesHistograms is true if every attribute has a histogram, unless s is empty
+func (s *Statistics) usesHistograms() bool {
+	for _, h := range s.Hgrams {
+		if len(h) == 0 && s.Size > 0 {
+			return false
+		}
+	}
+	return true
 }
 
 func classifyStatistics(stats []*Statistics) ([]*Statistics, []*Statistics) {
@@ -129,15 +205,10 @@ func classifyStatistics(stats []*Statistics) ([]*Statistics, []*Statistics) {
 }
 
 func EstimateJoinSize(tables []*Statistics) (int, *Statistics) {
-	hgrs, ests := classifyStatistics(tables)
-	if len(hgrs) == len(tables) {
+	if hgrs, _ := classifyStatistics(tables); len(hgrs) == len(tables) {
 		return hgramJoinStats(hgrs)
 	}
-	if len(ests) == len(tables) {
-		return naiveJoinStats(ests)
-	}
-	// todo mixed case
-	return -1, &Statistics{}
+	return naiveJoinStats(tables) // estimates or a mix, ndv is all they share
 }
 
 func hgramJoinStats(tables []*Statistics) (int, *Statistics) {
@@ -171,6 +242,7 @@ func hgramJoinStats(tables []*Statistics) (int, *Statistics) {
 
 	// todo ensure consistency between size and sum of hgrams
 	newStats.Size = int(math.Round(sel * sizes))
+	keepNdv(newStats, commonAttrs)
 	return newStats.Size, newStats
 }
 
@@ -256,12 +328,31 @@ func naiveJoinStats(tables []*Statistics) (int, *Statistics) {
 	return newStats.Size, newStats
 }
 
+// keepNdv sets the ndv of the attributes of a single table, which the histograms
+// do not estimate, to their ndv in that table, at most the size of s
+func keepNdv(s *Statistics, commonAttrs map[string][]RelationSchema) {
+	for attr, rels := range commonAttrs {
+		if len(rels) == 1 {
+			p, _ := rels[0].Position(attr)
+			ndv := rels[0].(*Statistics).Ndv[p]
+			if ndv > s.Size {
+				ndv = s.Size
+			}
+			s.SetNdv(attr, ndv)
+		}
+	}
+}
+
 func joinKMax(rels []*Statistics, attr string, k int) (int, int) {
 	var h IntHeap
 	heap.Init(&h)
 	for _, r := range rels {
 		if i, ok := r.Position(attr); ok {
-			heap.Push(&h, r.Ndv[i])
+			ndv := r.Ndv[i]
+			if ndv < 1 {
+				ndv = 1 // an unknown ndv gives no selectivity
+			}
+			heap.Push(&h, ndv)
 		} else {
 			panic(fmt.Errorf("%v not in %v", attr, r))
 		}
@@ -277,16 +368,12 @@ func EstimateSemijoinSize(left *Statistics, right *Statistics) (int, *Statistics
 	if left.usesHistograms() && right.usesHistograms() {
 		return hgramSemijoinStats(left, right)
 	}
-	if !left.usesHistograms() && !right.usesHistograms() {
-		return naiveSemijoinStats(left, right)
-	}
-	// todo mixed case
-	return -1, &Statistics{}
+	return naiveSemijoinStats(left, right)
 }
 
 func hgramSemijoinStats(left *Statistics, right *Statistics) (int, *Statistics) {
-	newAttrs, commonAttrs := JoinAttrs(StatsToRels(left, right)...)
-	emptyStats := NewStatistics(newAttrs)
+	_, commonAttrs := JoinAttrs(StatsToRels(left, right)...)
+	emptyStats := NewStatistics(left.attrs) // a semijoin keeps the attributes of left
 	newStats := emptyStats
 
 	if left.Size == 0 || right.Size == 0 {
@@ -295,7 +382,9 @@ func hgramSemijoinStats(left *Statistics, right *Statistics) (int, *Statistics)
 
 	sel := 1.0
 	for attr, rels := range commonAttrs {
-		if len(rels) > 1 {
+		if _, ok := left.attrPos[attr]; !ok {
+			delete(commonAttrs, attr) // keepNdv only sees the attributes of left
+		} else if len(rels) > 1 {
 			// rels = left,right
 			if d, empty := semijoinSelectivity(attr, left, right, newStats); !empty {
 				sel *= d
@@ -307,6 +396,7 @@ func hgramSemijoinStats(left *Statistics, right *Statistics) (int, *Statistics)
 
 	// todo ensure consistency between size and sum of hgrams
 	newStats.Size = int(math.Round(sel * float64(left.Size)))
+	keepNdv(newStats, commonAttrs)
 	return newStats.Size, newStats
 }
 
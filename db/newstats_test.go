@@ -0,0 +1,77 @@
+package db
+
+import "testing"
+
+// hgramStats builds the statistics of the tuples of codes, with histograms
+func hgramStats(attrs []string, tuples ...[]uint32) *Statistics {
+	s := NewStatistics(attrs)
+	for _, tup := range tuples {
+		s.AddTuple(tup)
+	}
+	return s
+}
+
+// ndvStats builds statistics with size and ndv only, as read from estimates
+func ndvStats(attrs []string, size int, ndv ...int) *Statistics {
+	s := NewStatistics(attrs)
+	s.SetSize(size)
+	for i, a := range attrs {
+		s.SetNdv(a, ndv[i])
+	}
+	return s
+}
+
+func TestUsesHistograms(t *testing.T) {
+	if !hgramStats([]string{"X"}, []uint32{1}).usesHistograms() {
+		t.Error("stats with histograms do not use them")
+	}
+	if ndvStats([]string{"X"}, 4, 2).usesHistograms() {
+		t.Error("stats with ndv only use histograms")
+	}
+	if !NewStatistics([]string{"X"}).usesHistograms() {
+		t.Error("empty stats do not use histograms")
+	}
+}
+
+func TestEstimateMixedStats(t *testing.T) {
+	hgram := hgramStats([]string{"X", "Y"}, []uint32{1, 1}, []uint32{1, 2}, []uint32{2, 3}, []uint32{3, 3})
+	ndv := ndvStats([]string{"Y", "Z"}, 10, 5, 10)
+
+	size, stats := EstimateJoinSize([]*Statistics{hgram, ndv})
+	wantSize, _ := naiveJoinStats([]*Statistics{hgram, ndv})
+	if size != wantSize || stats.Size != size {
+		t.Errorf("mixed join size %v (stats %v), want the ndv estimate %v", size, stats.Size, wantSize)
+	}
+	if attrs := stats.Attributes(); len(attrs) != 3 {
+		t.Errorf("mixed join has attributes %v, want X, Y, Z", attrs)
+	}
+
+	for _, tt := range []struct{ left, right *Statistics }{{hgram, ndv}, {ndv, hgram}} {
+		size, stats := EstimateSemijoinSize(tt.left, tt.right)
+		if size < 0 || size > tt.left.Size || stats.Size != size {
+			t.Errorf("mixed semijoin size %v (stats %v) of %v tuples", size, stats.Size, tt.left.Size)
+		}
+		if attrs := stats.Attributes(); len(attrs) != len(tt.left.Attributes()) {
+			t.Errorf("mixed semijoin has attributes %v, want those of %v", attrs, tt.left.Attributes())
+		}
+	}
+}
+
+func TestHgramSemijoinKeepsNdv(t *testing.T) {
+	left := hgramStats([]string{"X", "Y"}, []uint32{1, 1}, []uint32{2, 2}, []uint32{3, 3}, []uint32{4, 4})
+	right := hgramStats([]string{"Y", "Z"}, []uint32{1, 5}, []uint32{2, 6}, []uint32{2, 7})
+
+	size, stats := EstimateSemijoinSize(left, right)
+	if size != 2 {
+		t.Errorf("semijoin size %v, want 2", size)
+	}
+	if attrs := stats.Attributes(); len(attrs) != 2 || attrs[0] != "X" || attrs[1] != "Y" {
+		t.Errorf("semijoin has attributes %v, want [X Y]", attrs)
+	}
+	if got := stats.GetNdv("Y"); got != 2 {
+		t.Errorf("ndv of the join attribute %v, want 2", got)
+	}
+	if got := stats.GetNdv("X"); got != 2 {
+		t.Errorf("ndv of the attribute of left only %v, want 2, capped by the size", got)
+	}
+}
@@ -1,23 +1,47 @@
 package db
 
+import (
+	"fmt"
+)
+
 type Condition func(t Tuple) bool
 
+// Semijoin removes from l the tuples without a match in r, hashing the smaller input
 func Semijoin(l *Table, r Table) (*Table, bool) {
 	joinIdx := commonAttrs(*l, r)
 	if len(joinIdx) == 0 {
 		return l, false
 	}
+	r = *r.in(l.dict)
+	lPos, rPos := splitIndex(joinIdx)
 
-	var tupToDel []int
-	for i, leftTup := range l.Tuples {
-		delete := true
-		for _, rightTup := range r.Tuples {
-			if match(leftTup, rightTup, joinIdx) {
-				delete = false
-				break
+	var buf []byte
+	var ok bool
+	matched := make(map[string]bool)
+	if r.Size() <= l.Size() {
+		for j := 0; j < r.Size(); j++ {
+			if buf, ok = r.joinKey(buf, j, rPos); ok {
+				matched[string(buf)] = true
 			}
 		}
-		if delete {
+	} else {
+		for i := 0; i < l.Size(); i++ {
+			if buf, ok = l.joinKey(buf, i, lPos); ok {
+				matched[string(buf)] = false
+			}
+		}
+		for j := 0; j < r.Size(); j++ {
+			if buf, ok = r.joinKey(buf, j, rPos); ok {
+				if _, found := matched[string(buf)]; found {
+					matched[string(buf)] = true
+				}
+			}
+		}
+	}
+
+	var tupToDel []int
+	for i := 0; i < l.Size(); i++ {
+		if buf, ok = l.joinKey(buf, i, lPos); !ok || !matched[string(buf)] {
 			tupToDel = append(tupToDel, i)
 		}
 	}
@@ -29,18 +53,57 @@ func Semijoin(l *Table, r Table) (*Table, bool) {
 	return l, res
 }
 
+// Join hashes the smaller input and probes it with the tuples of the larger one,
+// which come first in the attributes of the result
 func Join(l Table, r Table) *Table {
 	if l.Size() < r.Size() {
 		l, r = r, l
 	}
+	r = *r.in(l.dict)
 	joinIdx := commonAttrs(l, r)
+	lPos, rPos := splitIndex(joinIdx)
 	newAttrs, _ := JoinAttrs(&l, &r)
-	newTab := NewTable(newAttrs, false) // todo compute stats?
-	for _, lTup := range l.Tuples {
-		for _, rTup := range r.Tuples {
-			if match(lTup, rTup, joinIdx) {
-				newTup := joinedTuple(newAttrs, lTup, rTup, r.attrPos)
-				newTab.AddTuple(newTup)
+	newTab := newJoinedTable(newAttrs, &l, &r) // todo compute stats?
+	rest := restPos(newAttrs, &l, &r)
+
+	var buf []byte
+	var ok bool
+	build := make(map[string][]int)
+	for j := 0; j < r.Size(); j++ {
+		if buf, ok = r.joinKey(buf, j, rPos); ok {
+			build[string(buf)] = append(build[string(buf)], j)
+		}
+	}
+	for i := 0; i < l.Size(); i++ {
+		if buf, ok = l.joinKey(buf, i, lPos); !ok {
+			continue
+		}
+		for _, j := range build[string(buf)] {
+			joinedTuple(newTab, &l, i, &r, j, rest)
+		}
+	}
+	return newTab
+}
+
+// Project keeps the attributes attrs of r, removing duplicate tuples
+func Project(r Table, attrs []string) *Table {
+	pos := make([]int, len(attrs))
+	for i, a := range attrs {
+		p, ok := r.attrPos[a]
+		if !ok {
+			panic(fmt.Errorf("attr %v does not exist", a))
+		}
+		pos[i] = p
+	}
+	newTab := newJoinedTable(attrs, &r)
+	var buf []byte
+	seen := make(map[string]bool)
+	for i := 0; i < r.Size(); i++ {
+		buf = r.hashKey(buf, i, pos)
+		if !seen[string(buf)] {
+			seen[string(buf)] = true
+			for k, p := range pos {
+				newTab.cols[k] = append(newTab.cols[k], r.cols[p][i])
 			}
 		}
 	}
@@ -49,8 +112,9 @@ func Join(l Table, r Table) *Table {
 
 func Select(r *Table, c Condition) (*Table, bool) {
 	var tupToDel []int
-	for i, tup := range r.Tuples {
-		if !c(tup) {
+	values := r.dict.snapshot()
+	for i := 0; i < r.Size(); i++ {
+		if !c(r.decode(values, i)) {
 			tupToDel = append(tupToDel, i)
 		}
 	}
@@ -79,21 +143,83 @@ func commonAttrs(left Table, right Table) [][]int {
 	return out
 }
 
-func match(left Tuple, right Tuple, joinIndex [][]int) bool {
+// match compares the codes of the i-th tuple of l and the j-th tuple of r,
+// which must share their dictionary
+func match(l *Table, i int, r *Table, j int, joinIndex [][]int) bool {
 	for _, z := range joinIndex {
-		if left[z[0]] != right[z[1]] {
+		if c := l.cols[z[0]][i]; c != r.cols[z[1]][j] || c == nullCode {
 			return false
 		}
 	}
 	return true
 }
 
-func joinedTuple(attrs []string, lTup Tuple, rTup Tuple, rAttrPos map[string]int) Tuple {
-	res := make(Tuple, 0, len(attrs))
-	res = append(res, lTup...)
-	for _, v := range attrs[len(lTup):] {
-		i := rAttrPos[v]
-		res = append(res, rTup[i])
+// splitIndex separates the positions in the left and right tables of commonAttrs
+func splitIndex(joinIndex [][]int) ([]int, []int) {
+	left := make([]int, len(joinIndex))
+	right := make([]int, len(joinIndex))
+	for i, z := range joinIndex {
+		left[i], right[i] = z[0], z[1]
+	}
+	return left, right
+}
+
+// hashKey encodes the codes of the i-th tuple of t at pos into buf, so that
+// equal values give equal keys
+func (t *Table) hashKey(buf []byte, i int, pos []int) []byte {
+	buf = buf[:0]
+	for _, p := range pos {
+		c := t.cols[p][i]
+		buf = append(buf, byte(c), byte(c>>8), byte(c>>16), byte(c>>24))
+	}
+	return buf
+}
+
+// joinKey is hashKey, false if a value at pos is Null and thus matches nothing
+func (t *Table) joinKey(buf []byte, i int, pos []int) ([]byte, bool) {
+	if t.hasNull(i, pos) {
+		return buf, false
+	}
+	return t.hashKey(buf, i, pos), true
+}
+
+func (t *Table) hasNull(i int, pos []int) bool {
+	for _, p := range pos {
+		if t.cols[p][i] == nullCode {
+			return true
+		}
+	}
+	return false
+}
+
+// newJoinedTable creates a table on attrs, each typed as in the first of tables that has it
+func newJoinedTable(attrs []string, tables ...*Table) *Table {
+	types := make([]Type, len(attrs))
+	for i, a := range attrs {
+		for _, t := range tables {
+			if p, ok := t.attrPos[a]; ok {
+				types[i] = t.types[p]
+				break
+			}
+		}
+	}
+	return newTable(attrs, types, tables[0].dict, false)
+}
+
+// restPos returns the positions in r of the attributes that follow those of l in attrs
+func restPos(attrs []string, l *Table, r *Table) []int {
+	rest := make([]int, 0, len(attrs)-len(l.attrs))
+	for _, a := range attrs[len(l.attrs):] {
+		rest = append(rest, r.attrPos[a])
+	}
+	return rest
+}
+
+// joinedTuple adds to dst the codes of the i-th tuple of l, followed by those
+// of the j-th tuple of r at the positions rest
+func joinedTuple(dst *Table, l *Table, i int, r *Table, j int, rest []int) {
+	l.appendRow(dst, i)
+	for k, p := range rest {
+		dst.cols[len(l.cols)+k] = append(dst.cols[len(l.cols)+k], r.cols[p][j])
 	}
-	return res
 }
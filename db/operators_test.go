@@ -2,7 +2,9 @@ package db
 
 import (
 	"fmt"
+	"math"
 	"math/rand"
+	"reflect"
 	"strconv"
 	"testing"
 )
@@ -54,11 +56,12 @@ func fakeSemijoin(l Table, r Table) int {
 		return 0
 	}
 
+	r = *r.in(l.dict)
 	var tupToDel []int
-	for i, leftTup := range l.Tuples {
+	for i := 0; i < l.Size(); i++ {
 		delete := true
-		for _, rightTup := range r.Tuples {
-			if match(leftTup, rightTup, joinIdx) {
+		for j := 0; j < r.Size(); j++ {
+			if match(&l, i, &r, j, joinIdx) {
 				delete = false
 				break
 			}
@@ -71,6 +74,194 @@ func fakeSemijoin(l Table, r Table) int {
 	return l.Size() - len(tupToDel)
 }
 
+func TestJoin(t *testing.T) {
+	small := NewTable([]string{"b", "d"}, false)
+	small.AddTuples([]Tuple{{"1", "x"}, {"2", "y"}, {"1", "z"}, {"", "w"}})
+	for _, r := range []*Table{tab1, small} {
+		for _, args := range [][2]*Table{{tab1, r}, {r, tab1}} {
+			want := NestedLoopJoin(*args[0], *args[1])
+			if got := Join(*args[0], *args[1]); !TablesEqual(*got, *want) {
+				t.Errorf("hash join of %v and %v: %v tuples, want %v", args[0].Attributes(), args[1].Attributes(), got.Size(), want.Size())
+			}
+			if got := SortMergeJoin(*args[0], *args[1]); !TablesDeepEqual(*got, *want) {
+				t.Errorf("sort-merge join of %v and %v: %v tuples, want %v", args[0].Attributes(), args[1].Attributes(), got.Size(), want.Size())
+			}
+		}
+	}
+}
+
+func TestChooseJoin(t *testing.T) {
+	one := NewTable([]string{"a"}, true)
+	one.AddTuple(Tuple{"1"})
+	sorted := NewTable([]string{"a", "e"}, true)
+	for i := 0; i < size1; i++ {
+		sorted.AddTuple(Tuple{strconv.Itoa(1000 + i), "x"})
+	}
+	cross := NewTable([]string{"e"}, false)
+	cross.AddTuple(Tuple{"x"})
+	tests := []struct {
+		l, r *Table
+		want JoinAlgorithm
+	}{
+		{tab1, one, NestedLoop},
+		{tab1, tab2, Hash},
+		{sorted, sorted, SortMerge},
+		{tab1, cross, NestedLoop},
+	}
+	for _, test := range tests {
+		if got := ChooseJoin(test.l, test.r); got != test.want {
+			t.Errorf("join of %v and %v tuples: chose %v, want %v", test.l.Size(), test.r.Size(), got, test.want)
+		}
+	}
+}
+
+func TestChooseJoinRenamed(t *testing.T) {
+	l := NewTable([]string{"a", "b"}, true)
+	r := NewTable([]string{"b", "c"}, true)
+	for i := 0; i < 50; i++ { // a single value of b, so the join is a cross product
+		l.AddTuple(Tuple{strconv.Itoa(i), "1"})
+		r.AddTuple(Tuple{"1", strconv.Itoa(i)})
+	}
+	tests := []struct {
+		l, r *Table
+	}{
+		{l, r},
+		{tab1, tab2},
+	}
+	for _, test := range tests {
+		want := ChooseJoin(test.l, test.r)
+		views := make([]*Table, 2)
+		for i, tab := range []*Table{test.l, test.r} {
+			attrs := make([]string, len(tab.Attributes()))
+			for j, a := range tab.Attributes() {
+				attrs[j] = "v_" + a
+			}
+			views[i] = tab.Rename(attrs)
+		}
+		if got := ChooseJoin(views[0], views[1]); got != want {
+			t.Errorf("join of %v and %v tuples: chose %v on the views, want %v", test.l.Size(), test.r.Size(), got, want)
+		}
+		if got := ChooseJoin(test.l.Copy(), test.r.Copy()); got != want {
+			t.Errorf("join of %v and %v tuples: chose %v on the copies, want %v", test.l.Size(), test.r.Size(), got, want)
+		}
+	}
+}
+
+// randomTable has n distinct tuples with values in [0, ndv), or all of them if fewer
+func randomTable(attrs []string, n int, ndv int) *Table {
+	if max := math.Pow(float64(ndv), float64(len(attrs))); float64(n) > max {
+		n = int(max)
+	}
+	t := NewTable(attrs, false)
+	seen := make(map[string]bool)
+	for t.Size() < n {
+		tup := make(Tuple, len(attrs))
+		for i := range tup {
+			tup[i] = strconv.Itoa(rand.Intn(ndv))
+		}
+		if key := fmt.Sprint(tup); !seen[key] {
+			seen[key] = true
+			t.AddTuple(tup)
+		}
+	}
+	return t
+}
+
+func TestGenericJoin(t *testing.T) {
+	rand.Seed(42)
+	tests := [][][]string{
+		{{"a", "b"}, {"b", "c"}, {"c", "a"}},             // triangle
+		{{"a", "b"}, {"b", "c"}, {"c", "d"}, {"d", "a"}}, // square
+		{{"a", "b", "c"}, {"c", "d"}, {"b", "d"}, {"a"}},
+		{{"a", "b"}, {"c"}, {"b", "d"}}, // with a cross product
+	}
+	for _, test := range tests {
+		var tables []*Table
+		for _, attrs := range test {
+			tables = append(tables, randomTable(attrs, 40, 8))
+		}
+		want := tables[0]
+		for _, tab := range tables[1:] {
+			want = Join(*want, *tab)
+		}
+		if got := GenericJoin(tables...); !TablesDeepEqual(*got, *want) {
+			t.Errorf("generic join of %v: %v tuples, want %v", test, got.Size(), want.Size())
+		}
+	}
+}
+
+func TestTypedOperators(t *testing.T) {
+	r := NewTypedTable([]string{"a", "b"}, []Type{Int, String}, false)
+	r.AddTuples([]Tuple{{int64(1), "x"}, {int64(2), "y"}, {int64(10), "z"}})
+	s := NewTypedTable([]string{"a", "c"}, []Type{Int, Float}, false)
+	s.AddTuples([]Tuple{{int64(10), 0.5}, {int64(1), 1.5}, {int64(1), 2.5}})
+	str := NewTable([]string{"a"}, false) // the same values, but strings
+	str.AddTuples([]Tuple{{"1"}, {"2"}, {"10"}})
+
+	for _, alg := range []JoinAlgorithm{NestedLoop, Hash, SortMerge} {
+		j := JoinWith(alg, *r, *s)
+		if j.Size() != 3 || j.Type("c") != Float || j.Type("a") != Int {
+			t.Errorf("%v join: %v", alg, j)
+		}
+		if j := JoinWith(alg, *r, *str); !j.Empty() {
+			t.Errorf("%v join matched ints and strings: %v", alg, j)
+		}
+	}
+	if got, _ := Semijoin(r.Copy(), *s); got.Size() != 2 {
+		t.Errorf("semijoin: %v", got)
+	}
+	big, _ := Select(s.Copy(), func(tup Tuple) bool { return Compare(tup[1], 1.0) > 0 })
+	if big.Size() != 2 {
+		t.Errorf("select c > 1.0: %v", big)
+	}
+	if ord := r.sortedOrder(r.dict.snapshot(), []int{0}); !reflect.DeepEqual(ord, []int{0, 1, 2}) {
+		t.Errorf("ints sorted as strings: %v", ord)
+	}
+}
+
+func TestJoinDicts(t *testing.T) {
+	d := NewDict()
+	d.Encode("unused") // so that the codes of the two dictionaries differ
+	r := newTable([]string{"a", "b"}, []Type{String, String}, d, false)
+	r.AddTuples([]Tuple{{"1", "x"}, {"2", "y"}, {"3", "z"}})
+	s := NewTable([]string{"b", "c"}, false)
+	s.AddTuples([]Tuple{{"y", "4"}, {"z", "5"}, {"w", "6"}})
+
+	want := NewTable([]string{"a", "b", "c"}, false)
+	want.AddTuples([]Tuple{{"2", "y", "4"}, {"3", "z", "5"}})
+	for _, alg := range []JoinAlgorithm{NestedLoop, Hash, SortMerge} {
+		if got := JoinWith(alg, *r, *s); !TablesDeepEqual(*got, *want) {
+			t.Errorf("%v join across dictionaries: %v", alg, got.Tuples())
+		}
+	}
+	if got := GenericJoin(s, r); !TablesDeepEqual(*got, *want) {
+		t.Errorf("generic join across dictionaries: %v", got.Tuples())
+	}
+	if got, _ := Semijoin(s.Copy(), *r); got.Size() != 2 {
+		t.Errorf("semijoin across dictionaries: %v", got.Tuples())
+	}
+	if r.Dict() != d || s.Dict() == d {
+		t.Error("the joins recoded their inputs")
+	}
+}
+
+func TestSemijoin(t *testing.T) {
+	small := NewTable([]string{"b", "d"}, false)
+	small.AddTuples([]Tuple{{"1", "x"}, {"2", "y"}, {"1", "z"}})
+	for _, args := range [][2]*Table{{tab1, small}, {small, tab1}} {
+		l := args[0].Copy()
+		Semijoin(l, *args[1])
+		if want := fakeSemijoin(*args[0], *args[1]); l.Size() != want {
+			t.Errorf("semijoin of %v and %v: %v tuples, want %v", args[0].Attributes(), args[1].Attributes(), l.Size(), want)
+		}
+		for _, tup := range l.Tuples() {
+			if !containsTuple(tup, l.Attributes(), args[0], args[0].Tuples()) {
+				t.Errorf("semijoin added %v", tup)
+			}
+		}
+	}
+}
+
 func BenchmarkJoinSmallBig(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		Join(*tab1, *tab2)
@@ -83,6 +274,48 @@ func BenchmarkJoinBigSmall(b *testing.B) {
 	}
 }
 
+func BenchmarkNestedLoopJoinSmallBig(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		NestedLoopJoin(*tab1, *tab2)
+	}
+}
+
+func BenchmarkNestedLoopJoinBigSmall(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		NestedLoopJoin(*tab2, *tab1)
+	}
+}
+
+func BenchmarkSortMergeJoinSmallBig(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		SortMergeJoin(*tab1, *tab2)
+	}
+}
+
+func BenchmarkSortMergeJoinBigSmall(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		SortMergeJoin(*tab2, *tab1)
+	}
+}
+
+func BenchmarkGenericJoinTriangle(b *testing.B) {
+	rand.Seed(42)
+	r, s, t := randomTable([]string{"a", "b"}, size1, m), randomTable([]string{"b", "c"}, size1, m), randomTable([]string{"c", "a"}, size1, m)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		GenericJoin(r, s, t)
+	}
+}
+
+func BenchmarkPairwiseJoinTriangle(b *testing.B) {
+	rand.Seed(42)
+	r, s, t := randomTable([]string{"a", "b"}, size1, m), randomTable([]string{"b", "c"}, size1, m), randomTable([]string{"c", "a"}, size1, m)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		Join(*Join(*r, *s), *t)
+	}
+}
+
 func BenchmarkSemijoin1(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		fakeSemijoin(*tab1, *tab2)
@@ -94,3 +327,15 @@ func BenchmarkSemijoin2(b *testing.B) {
 		fakeSemijoin(*tab2, *tab1)
 	}
 }
+
+func BenchmarkHashSemijoin1(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		Semijoin(tab1.Copy(), *tab2)
+	}
+}
+
+func BenchmarkHashSemijoin2(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		Semijoin(tab2.Copy(), *tab1)
+	}
+}
@@ -5,12 +5,16 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strings"
 )
 
 // Tuple represent a row in a relation
-type Tuple []string
+type Tuple []Value
 type Database map[string]*Table
 
+// Load reads a database of r lines, declaring a table and its attributes, each
+// followed by the t lines of its tuples. An attribute can declare its type as
+// name:int or name:float, otherwise its values are strings.
 func Load(dbPath string) Database {
 	csvfile, err := os.Open(dbPath)
 	if err != nil {
@@ -18,6 +22,7 @@ func Load(dbPath string) Database {
 	}
 
 	db := make(Database)
+	dict := NewDict()
 	var currName string
 	r := csv.NewReader(csvfile)
 	r.FieldsPerRecord = -1
@@ -34,13 +39,14 @@ func Load(dbPath string) Database {
 		switch kind {
 		case "r":
 			currName = record[1]
-			attrs := record[2:]
-			db[currName] = NewTable(attrs, true)
+			attrs, types := parseAttrs(record[2:])
+			db[currName] = newTable(attrs, types, dict, true)
 		case "t":
-			tup := record[1:]
-			if _, ok := db[currName].AddTuple(tup); !ok {
-				panic(fmt.Errorf("%v is not a valid tuple for %v", tup, currName))
+			tup, err := db[currName].ParseTuple(record[1:])
+			if err != nil {
+				panic(fmt.Errorf("%v is not a valid tuple for %v: %v", record[1:], currName, err))
 			}
+			db[currName].AddTuple(tup)
 		default:
 			panic(fmt.Errorf("%v is not a valid type", kind))
 		}
@@ -49,16 +55,52 @@ func Load(dbPath string) Database {
 	return db
 }
 
+// parseAttrs splits the declarations name:type of attributes
+func parseAttrs(decls []string) ([]string, []Type) {
+	attrs := make([]string, len(decls))
+	types := make([]Type, len(decls))
+	for i, d := range decls {
+		attrs[i] = d
+		if j := strings.LastIndexByte(d, ':'); j >= 0 {
+			if t, err := ParseType(d[j+1:]); err == nil {
+				attrs[i], types[i] = d[:j], t
+			}
+		}
+	}
+	return attrs, types
+}
+
+// Table stores a vector of codes for each attribute, encoded by a dictionary
+// shared with the other tables of its database
 type Table struct {
 	attrs   []string
 	attrPos map[string]int
-	Tuples  []Tuple
+	types   []Type
+	dict    *Dict
+	cols    [][]uint32
 
 	Stats *Statistics
 }
 
+// NewTable creates a table whose attributes are strings, with a dictionary of its own
 func NewTable(attrs []string, stats bool) *Table {
-	if len(attrs) <= 0 {
+	return NewTypedTable(attrs, make([]Type, len(attrs)), stats)
+}
+
+// NewTypedTable creates a table whose attributes have the given types, with a
+// dictionary of its own
+func NewTypedTable(attrs []string, types []Type, stats bool) *Table {
+	return newTable(attrs, types, NewDict(), stats)
+}
+
+// NewDictTable creates a table whose attributes have the given types, encoded
+// by dict. Histograms only compare the values of tables sharing a dictionary.
+func NewDictTable(attrs []string, types []Type, dict *Dict, stats bool) *Table {
+	return newTable(attrs, types, dict, stats)
+}
+
+func newTable(attrs []string, types []Type, dict *Dict, stats bool) *Table {
+	if len(attrs) <= 0 || len(types) != len(attrs) {
 		panic(fmt.Errorf("%v is not valid", attrs))
 	}
 
@@ -69,7 +111,9 @@ func NewTable(attrs []string, stats bool) *Table {
 	}
 	t.attrs = attrs
 	t.attrPos = attrPos
-	t.Tuples = make([]Tuple, 0)
+	t.types = types
+	t.dict = dict
+	t.cols = make([][]uint32, len(attrs))
 	if stats {
 		t.Stats = NewStatistics(t.attrs)
 	}
@@ -77,35 +121,139 @@ func NewTable(attrs []string, stats bool) *Table {
 	return &t
 }
 
+// Copy returns a table with the tuples and the statistics of t, which can be
+// reduced without changing t. Columns are shared until one of the tables grows.
+func (t *Table) Copy() *Table {
+	return t.Rename(t.attrs)
+}
+
+// Rename returns a view of t with the given attributes, which shares its
+// tuples like Copy and keeps its statistics under the new names
+func (t *Table) Rename(attrs []string) *Table {
+	if len(attrs) != len(t.attrs) {
+		panic(fmt.Errorf("%v attributes to rename %v", len(attrs), t.attrs))
+	}
+	res := newTable(attrs, t.types, t.dict, false)
+	for i, col := range t.cols {
+		res.cols[i] = col[:len(col):len(col)]
+	}
+	if t.Stats != nil {
+		res.Stats = t.Stats.withAttrs(attrs)
+	}
+	return res
+}
+
 func (t *Table) Size() int {
-	return len(t.Tuples)
+	return len(t.cols[0])
 }
 
 func (t *Table) Attributes() []string {
 	return t.attrs
 }
 
+func (t *Table) Types() []Type {
+	return t.types
+}
+
+// Type returns the type of attr, which must be an attribute of t
+func (t *Table) Type(attr string) Type {
+	p, ok := t.attrPos[attr]
+	if !ok {
+		panic(fmt.Errorf("attr %v does not exist", attr))
+	}
+	return t.types[p]
+}
+
+// Dict returns the dictionary that encodes the values of t
+func (t *Table) Dict() *Dict {
+	return t.dict
+}
+
 func (t *Table) Position(attr string) (pos int, ok bool) {
 	pos, ok = t.attrPos[attr]
 	return
 }
 
 func (t *Table) Empty() bool {
-	return len(t.Tuples) == 0
+	return t.Size() == 0
+}
+
+// Tuple decodes the i-th tuple of t
+func (t *Table) Tuple(i int) Tuple {
+	return t.decode(t.dict.snapshot(), i)
 }
 
-func (t *Table) AddTuple(vals []string) (Tuple, bool) {
+// Tuples decodes all the tuples of t at once, in the order they were added.
+// Tuple decodes them one at a time instead.
+//
+// Tuples replaces the field of the same name of the row-based tables, which is
+// a breaking change: code that ranged over t.Tuples has to call t.Tuples()
+// instead, and gets the same tuples in the same order. The slice is new at
+// every call, so changing it does not change t, as AddTuple and RemoveTuples do.
+func (t *Table) Tuples() []Tuple {
+	values := t.dict.snapshot()
+	res := make([]Tuple, t.Size())
+	for i := range res {
+		res[i] = t.decode(values, i)
+	}
+	return res
+}
+
+func (t *Table) decode(values []Value, i int) Tuple {
+	tup := make(Tuple, len(t.cols))
+	for j, col := range t.cols {
+		tup[j] = values[col[i]]
+	}
+	return tup
+}
+
+// AddTuple appends vals to t, if it has a value of the right type for each attribute
+func (t *Table) AddTuple(vals Tuple) (Tuple, bool) {
 	if len(t.attrs) != len(vals) {
 		return nil, false
 	}
+	for i, v := range vals {
+		if typ, ok := TypeOf(v); v != Null && (!ok || typ != t.types[i]) {
+			return nil, false
+		}
+	}
 	// duplicates allowed
-	t.Tuples = append(t.Tuples, vals)
+	codes := make([]uint32, len(vals))
+	for i, v := range vals {
+		codes[i] = t.dict.Encode(v)
+		t.cols[i] = append(t.cols[i], codes[i])
+	}
 	if t.Stats != nil {
-		t.Stats.AddTuple(vals)
+		t.Stats.AddTuple(codes)
 	}
 	return vals, true
 }
 
+// ParseTuple reads the values of a tuple of t
+func (t *Table) ParseTuple(vals []string) (Tuple, error) {
+	return t.parseTuple(vals, "")
+}
+
+// parseTuple reads the values of a tuple of t, with null as the marker of Null if not empty
+func (t *Table) parseTuple(vals []string, null string) (Tuple, error) {
+	if len(vals) != len(t.attrs) {
+		return nil, fmt.Errorf("%v values for %v attributes", len(vals), len(t.attrs))
+	}
+	tup := make(Tuple, len(vals))
+	for i, s := range vals {
+		if null != "" && s == null {
+			tup[i] = Null
+			continue
+		}
+		v, err := ParseValue(t.types[i], s)
+		if err != nil {
+			return nil, fmt.Errorf("%v is not a valid %v for %v", s, t.types[i], t.attrs[i])
+		}
+		tup[i] = v
+	}
+	return tup, nil
+}
+
 func (t *Table) AddTuples(tuples []Tuple) bool {
 	for _, tup := range tuples {
 		if _, ok := t.AddTuple(tup); !ok {
@@ -115,27 +263,60 @@ func (t *Table) AddTuples(tuples []Tuple) bool {
 	return true
 }
 
+// RemoveTuples removes the tuples at the sorted positions idx
 func (t *Table) RemoveTuples(idx []int) (bool, error) {
 	if len(idx) == 0 {
 		return false, nil
 	}
 
-	newSize := len(t.Tuples) - len(idx)
+	newSize := t.Size() - len(idx)
 	if newSize < 0 {
 		return false, fmt.Errorf("new size %v < 0", newSize)
 	}
-	newTuples := make([]Tuple, 0, newSize)
-	if newSize > 0 {
-		i := 0
-		for _, j := range idx {
-			newTuples = append(newTuples, t.Tuples[i:j]...)
-			i = j + 1
+	for c, col := range t.cols {
+		newCol := make([]uint32, 0, newSize)
+		if newSize > 0 {
+			i := 0
+			for _, j := range idx {
+				newCol = append(newCol, col[i:j]...)
+				i = j + 1
+			}
+			newCol = append(newCol, col[i:]...)
 		}
-		newTuples = append(newTuples, t.Tuples[i:]...)
+		t.cols[c] = newCol
 	}
-	t.Tuples = newTuples
 
 	// TODO stats update is missing
 
 	return true, nil
 }
+
+// in returns t encoded by d, recoding its columns if t has another dictionary
+func (t *Table) in(d *Dict) *Table {
+	if t.dict == d {
+		return t
+	}
+	values := t.dict.snapshot()
+	res := newTable(t.attrs, t.types, d, false)
+	recoded := make(map[uint32]uint32)
+	for i, col := range t.cols {
+		newCol := make([]uint32, len(col))
+		for j, c := range col {
+			nc, ok := recoded[c]
+			if !ok {
+				nc = d.Encode(values[c])
+				recoded[c] = nc
+			}
+			newCol[j] = nc
+		}
+		res.cols[i] = newCol
+	}
+	return res
+}
+
+// appendRow adds the codes of the i-th tuple of t to the first columns of dst
+func (t *Table) appendRow(dst *Table, i int) {
+	for c, col := range t.cols {
+		dst.cols[c] = append(dst.cols[c], col[i])
+	}
+}
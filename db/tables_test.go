@@ -1,9 +1,15 @@
 package db
 
 import (
+	"bufio"
 	"fmt"
+	"io"
 	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -33,11 +39,139 @@ func init() {
 }
 
 func BenchmarkRemoveTuples(b *testing.B) {
-	tups := append([]Tuple(nil), tab.Tuples...)
-	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		tab.RemoveTuples(del)
-		tab.Tuples = make([]Tuple, len(tups))
-		copy(tab.Tuples, tups)
+		tab.Copy().RemoveTuples(del)
+	}
+}
+
+func TestLoadTypes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "typed.db")
+	content := "r,r,a:int,b,c:float,d:e\nt,1,x,2.5,y\nt,-3,,1e3,z\nr,s,a\nt,1\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	d := Load(path)
+	r := d["r"]
+	if got := r.Attributes(); !reflect.DeepEqual(got, []string{"a", "b", "c", "d:e"}) {
+		t.Errorf("attributes %v", got)
+	}
+	if got := r.Types(); !reflect.DeepEqual(got, []Type{Int, String, Float, String}) {
+		t.Errorf("types %v", got)
+	}
+	want := []Tuple{{int64(1), "x", 2.5, "y"}, {int64(-3), "", 1000.0, "z"}}
+	if !reflect.DeepEqual(r.Tuples(), want) {
+		t.Errorf("tuples %v, want %v", r.Tuples(), want)
+	}
+	one, _ := r.Dict().Code(int64(1))
+	if r.Stats.Hgrams[0].Frequency(one) != 1 {
+		t.Errorf("histogram of a is %v", r.Stats.Hgrams[0])
+	}
+	s := d["s"]
+	if s.Types()[0] != String || s.Tuple(0)[0] != "1" {
+		t.Errorf("untyped table %v", s)
+	}
+	if c, _ := s.Dict().Code("1"); s.Dict() != r.Dict() || c == one {
+		t.Errorf("the tables do not share a dictionary")
+	}
+}
+
+func TestParseTuple(t *testing.T) {
+	tab := NewTypedTable([]string{"a", "b"}, []Type{Int, Float}, false)
+	for _, vals := range [][]string{{"1.5", "2"}, {"x", "2"}, {"1", "y"}, {"1"}} {
+		if tup, err := tab.ParseTuple(vals); err == nil {
+			t.Errorf("%v parsed as %v", vals, tup)
+		}
+	}
+	if _, ok := tab.AddTuple(Tuple{"1", 2.0}); ok {
+		t.Error("added a string to an int attribute")
+	}
+	if _, ok := tab.AddTuple(Tuple{int64(1), 2.0}); !ok {
+		t.Error("a valid tuple was not added")
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"r.csv": "a:int;b\n1;'x;y'\n\n2;'it''s'\r\n3;NA\n",
+		"s.csv": "b;c:float\n'x;y';0.5\nNA;1\n'multi\nline';2",
+		"t.txt": "not;a;table\n",
+		"u.csv": "a:int\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "v.csv"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	d := LoadDir(dir, CSVOptions{Comma: ';', Quote: '\'', Null: "NA", Ext: ".csv"})
+	if len(d) != 3 || d["r"] == nil || d["s"] == nil || d["u"] == nil {
+		t.Fatalf("loaded tables %v", d)
+	}
+	want := []Tuple{{int64(1), "x;y"}, {int64(2), "it's"}, {int64(3), Null}}
+	if got := d["r"].Tuples(); !reflect.DeepEqual(got, want) {
+		t.Errorf("r has tuples %v, want %v", got, want)
+	}
+	want = []Tuple{{"x;y", 0.5}, {Null, 1.0}, {"multi\nline", 2.0}}
+	if got := d["s"].Tuples(); !reflect.DeepEqual(got, want) {
+		t.Errorf("s has tuples %v, want %v", got, want)
+	}
+	if d["r"].Dict() != d["s"].Dict() || !d["u"].Empty() {
+		t.Error("the tables do not share a dictionary")
+	}
+
+	// Null joins with nothing, not even Null
+	if j := Join(*d["r"], *d["s"]); j.Size() != 1 || j.Tuple(0)[0] != int64(1) {
+		t.Errorf("r join s is %v", j.Tuples())
+	}
+	for _, alg := range []JoinAlgorithm{NestedLoop, SortMerge} {
+		if j := JoinWith(alg, *d["r"], *d["s"]); j.Size() != 1 {
+			t.Errorf("%v join of r and s is %v", alg, j.Tuples())
+		}
+	}
+	if j := GenericJoin(d["r"], d["s"], d["s"].Copy()); j.Size() != 1 {
+		t.Errorf("generic join of r and s is %v", j.Tuples())
+	}
+	if sj, _ := Semijoin(d["s"].Copy(), *d["r"]); sj.Size() != 1 {
+		t.Errorf("s semijoin r is %v", sj.Tuples())
+	}
+}
+
+func TestCSVReader(t *testing.T) {
+	tests := []struct {
+		in      string
+		quote   rune
+		records [][]string
+	}{
+		{"a,b\n\"c,d\",\"\"\n", '"', [][]string{{"a", "b"}, {"c,d", ""}}},
+		{"a,\"b\"\"\"\r\n,\n", '"', [][]string{{"a", "b\""}, {"", ""}}},
+		{"\"a,b\n", 0, [][]string{{"\"a", "b"}}},
+		{"a\n\n\r\nb", '"', [][]string{{"a"}, {"b"}}},
+	}
+	for _, test := range tests {
+		r := &csvReader{in: bufio.NewReader(strings.NewReader(test.in)), comma: ',', quote: test.quote}
+		var got [][]string
+		for {
+			record, err := r.read()
+			if err != nil {
+				if err != io.EOF {
+					t.Errorf("%q: %v", test.in, err)
+				}
+				break
+			}
+			got = append(got, append([]string(nil), record...))
+		}
+		if !reflect.DeepEqual(got, test.records) {
+			t.Errorf("%q: records %q, want %q", test.in, got, test.records)
+		}
+	}
+	for _, in := range []string{"\"a", "\"a\"b"} {
+		r := &csvReader{in: bufio.NewReader(strings.NewReader(in)), comma: ',', quote: '"'}
+		if _, err := r.read(); err == nil || err == io.EOF {
+			t.Errorf("%q: no error", in)
+		}
 	}
 }
@@ -12,8 +12,8 @@ func TablesEqual(t1 Table, t2 Table) bool {
 	if t1.Size() != t2.Size() {
 		return false
 	}
-	for i := range t1.Tuples {
-		if !TuplesEqual(t1.Tuples[i], t2.Tuples[i]) {
+	for i := 0; i < t1.Size(); i++ {
+		if !TuplesEqual(t1.Tuple(i), t2.Tuple(i)) {
 			return false
 		}
 	}
@@ -49,21 +49,22 @@ func TablesDeepEqual(tab1 Table, tab2 Table) bool {
 	if tab1.Size() != tab2.Size() {
 		return false
 	}
-	for _, tup1 := range tab1.Tuples {
-		if !containsTuple(tup1, tab1.attrs, &tab2) {
+	tuples1, tuples2 := tab1.Tuples(), tab2.Tuples()
+	for _, tup1 := range tuples1 {
+		if !containsTuple(tup1, tab1.attrs, &tab2, tuples2) {
 			return false
 		}
 	}
-	for _, tup2 := range tab2.Tuples {
-		if !containsTuple(tup2, tab2.attrs, &tab1) {
+	for _, tup2 := range tuples2 {
+		if !containsTuple(tup2, tab2.attrs, &tab1, tuples1) {
 			return false
 		}
 	}
 	return true
 }
 
-func containsTuple(tup Tuple, attrs []string, tab *Table) bool {
-	for _, tup2 := range tab.Tuples {
+func containsTuple(tup Tuple, attrs []string, tab *Table, tuples []Tuple) bool {
+	for _, tup2 := range tuples {
 		found := true
 		if len(tup) != len(tup2) {
 			found = false
@@ -0,0 +1,170 @@
+package db
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Type is the type of the values of an attribute
+type Type int
+
+const (
+	String Type = iota
+	Int
+	Float
+)
+
+func (t Type) String() string {
+	switch t {
+	case String:
+		return "string"
+	case Int:
+		return "int"
+	case Float:
+		return "float"
+	default:
+		return "type " + strconv.Itoa(int(t))
+	}
+}
+
+// ParseType reads the name of a type, as written by String
+func ParseType(name string) (Type, error) {
+	switch strings.ToLower(name) {
+	case "string":
+		return String, nil
+	case "int":
+		return Int, nil
+	case "float":
+		return Float, nil
+	default:
+		return String, fmt.Errorf("%v is not a type", name)
+	}
+}
+
+// Value is a value of a tuple, either a string, an int64 or a float64.
+// Values of different types are never equal, not even 1 and 1.0.
+type Value interface{}
+
+// Null is the value of a missing attribute, of any type. As in SQL, it
+// matches nothing in a join, not even Null.
+var Null Value = null{}
+
+type null struct{}
+
+// TypeOf returns the type of v, false if v has no valid type
+func TypeOf(v Value) (Type, bool) {
+	switch v.(type) {
+	case string:
+		return String, true
+	case int64:
+		return Int, true
+	case float64:
+		return Float, true
+	default:
+		return String, false
+	}
+}
+
+// ParseValue reads a value of type t
+func ParseValue(t Type, s string) (Value, error) {
+	switch t {
+	case Int:
+		return strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	case Float:
+		return strconv.ParseFloat(strings.TrimSpace(s), 64)
+	default:
+		return s, nil
+	}
+}
+
+// FormatValue writes v so that ParseValue reads it back, Null as an empty string
+func FormatValue(v Value) string {
+	switch x := v.(type) {
+	case null:
+		return ""
+	case string:
+		return x
+	case int64:
+		return strconv.FormatInt(x, 10)
+	case float64:
+		return strconv.FormatFloat(x, 'g', -1, 64)
+	default:
+		return fmt.Sprint(x)
+	}
+}
+
+// Compare orders values by type, then numbers by value and strings
+// lexicographically, with Null first. It returns -1, 0 or 1 as a is less,
+// equal or greater than b.
+func Compare(a Value, b Value) int {
+	if a == Null || b == Null {
+		return compareOrdered(a == Null && b != Null, a != Null && b == Null)
+	}
+	ta, _ := TypeOf(a)
+	tb, _ := TypeOf(b)
+	if ta != tb {
+		if ta < tb {
+			return -1
+		}
+		return 1
+	}
+	switch x := a.(type) {
+	case int64:
+		return compareOrdered(x < b.(int64), x > b.(int64))
+	case float64:
+		return compareOrdered(x < b.(float64), x > b.(float64))
+	default:
+		return strings.Compare(x.(string), b.(string))
+	}
+}
+
+func compareOrdered(less bool, greater bool) int {
+	if less {
+		return -1
+	} else if greater {
+		return 1
+	}
+	return 0
+}
+
+// Strings formats the values of tup
+func (tup Tuple) Strings() []string {
+	res := make([]string, len(tup))
+	for i, v := range tup {
+		res[i] = FormatValue(v)
+	}
+	return res
+}
+
+// Key encodes tup so that only equal tuples have equal keys
+func (tup Tuple) Key() string {
+	var b []byte
+	for _, v := range tup {
+		b = appendKey(b, v)
+	}
+	return string(b)
+}
+
+// appendKey encodes v after a tag of its type, so that different values
+// of any type give different keys
+func appendKey(b []byte, v Value) []byte {
+	switch x := v.(type) {
+	case null:
+		return append(b, 'n')
+	case int64:
+		b = append(b, 'i')
+		b = strconv.AppendInt(b, x, 10)
+		return append(b, ';')
+	case float64:
+		b = append(b, 'f')
+		b = strconv.AppendFloat(b, x, 'g', -1, 64)
+		return append(b, ';')
+	default:
+		s := x.(string)
+		b = append(b, 's')
+		b = strconv.AppendInt(b, int64(len(s)), 10)
+		b = append(b, ':')
+		return append(b, s...)
+	}
+}
@@ -0,0 +1,85 @@
+package decomp
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// ToDOT draws dec in the Graphviz DOT language, numbering the nodes as ToTD.
+// If ev is not nil, nodes are annotated with their EvalNode size and tree
+// edges with the size of the parent reduced by the child, as summed
+// by EvalTree. The most expensive node and edge are highlighted in red.
+func ToDOT(dec Decomp, ev *Evaluator, names map[int]string) string {
+	tree := MakeSearchTree(dec)
+	nodes := tree.dfs()
+	ids := make(map[*SearchNode]int, len(nodes))
+	for i, n := range nodes {
+		ids[n] = i + 1
+	}
+
+	nodeCosts := make(map[*SearchNode]int)
+	edgeCosts := make(map[*SearchNode]int) // by child
+	var maxNode, maxEdge *SearchNode
+	total := 0
+	if ev != nil {
+		total = ev.evalTree(tree, func(n *SearchNode, child *SearchNode, cost int) {
+			if child == nil {
+				nodeCosts[n] = cost
+				if maxNode == nil || cost > nodeCosts[maxNode] {
+					maxNode = n
+				}
+			} else {
+				edgeCosts[child] = cost
+				if maxEdge == nil || cost > edgeCosts[maxEdge] {
+					maxEdge = child
+				}
+			}
+		})
+	}
+
+	var buffer bytes.Buffer
+	buffer.WriteString("digraph decomp {\n")
+	if ev != nil {
+		fmt.Fprintf(&buffer, "  label=\"cost %v\";\n", total)
+	}
+	buffer.WriteString("  node [shape=box];\n")
+	for _, n := range nodes {
+		var cover, bag []string
+		for _, e := range n.sep.Slice() {
+			cover = append(cover, names[e.Name])
+		}
+		for _, v := range n.bag {
+			bag = append(bag, names[v])
+		}
+		label := "{" + strings.Join(cover, ", ") + "}\\n{" + strings.Join(bag, ", ") + "}"
+		if ev != nil {
+			label += fmt.Sprintf("\\nsize %v", nodeCosts[n])
+		}
+		fmt.Fprintf(&buffer, "  n%v [label=\"%v\"", ids[n], dotEscape(label))
+		if n == maxNode {
+			buffer.WriteString(", color=red, fontcolor=red, penwidth=2")
+		}
+		buffer.WriteString("];\n")
+	}
+	for _, n := range nodes {
+		for _, child := range n.children {
+			fmt.Fprintf(&buffer, "  n%v -> n%v", ids[n], ids[child])
+			if ev != nil {
+				fmt.Fprintf(&buffer, " [label=\"semijoin %v\"", edgeCosts[child])
+				if child == maxEdge {
+					buffer.WriteString(", color=red, fontcolor=red, penwidth=2")
+				}
+				buffer.WriteString("]")
+			}
+			buffer.WriteString(";\n")
+		}
+	}
+	buffer.WriteString("}\n")
+	return buffer.String()
+}
+
+// dotEscape escapes the quotes in a label, keeping the \n line breaks
+func dotEscape(label string) string {
+	return strings.ReplaceAll(label, `"`, `\"`)
+}
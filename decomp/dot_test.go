@@ -0,0 +1,31 @@
+package decomp
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/cem-okulmus/BalancedGo/lib"
+)
+
+func TestToDOT(t *testing.T) {
+	hg, parsed := lib.GetGraph("a(X,Y), b(Y,Z), c(Z,W).")
+	dec, err := ParseGML(paceGML, hg, parsed.Encoding)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := testEvaluator(t, hg, parsed.Encoding, pathStats).Eval(dec)
+	got := ToDOT(dec, testEvaluator(t, hg, parsed.Encoding, pathStats), Names(parsed.Encoding))
+	if !strings.Contains(got, fmt.Sprintf("label=\"cost %v\"", want)) {
+		t.Errorf("cost %v missing in\n%v", want, got)
+	}
+	if !strings.Contains(got, `n1 [label="{b}\n{Y, Z}\nsize`) {
+		t.Errorf("root is not n1 in\n%v", got)
+	}
+	if n := strings.Count(got, "penwidth=2"); n != 2 {
+		t.Errorf("%v highlights, want a node and an edge in\n%v", n, got)
+	}
+	if plain := ToDOT(dec, nil, Names(parsed.Encoding)); strings.Contains(plain, "size") || strings.Contains(plain, "color=red") {
+		t.Errorf("annotations without evaluator in\n%v", plain)
+	}
+}
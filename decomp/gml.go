@@ -0,0 +1,315 @@
+package decomp
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/cem-okulmus/BalancedGo/lib"
+)
+
+// gmlValue is either a flat value or a list of key-value pairs
+type gmlValue struct {
+	flat string
+	list []gmlEntry
+	line int
+}
+
+type gmlEntry struct {
+	key   string
+	value gmlValue
+}
+
+type gmlParser struct {
+	input []rune
+	pos   int
+	line  int
+}
+
+func (p *gmlParser) skipSpaces() {
+	for p.pos < len(p.input) {
+		c := p.input[p.pos]
+		if c == '#' { // comment until the end of the line
+			for p.pos < len(p.input) && p.input[p.pos] != '\n' {
+				p.pos++
+			}
+			continue
+		}
+		if !unicode.IsSpace(c) {
+			return
+		}
+		if c == '\n' {
+			p.line++
+		}
+		p.pos++
+	}
+}
+
+// token returns the next key, flat value, "[" or "]", or "" at the end of the input
+func (p *gmlParser) token() (string, error) {
+	p.skipSpaces()
+	if p.pos >= len(p.input) {
+		return "", nil
+	}
+	c := p.input[p.pos]
+	switch {
+	case c == '[' || c == ']':
+		p.pos++
+		return string(c), nil
+	case c == '"':
+		startLine := p.line
+		end := p.pos + 1
+		for end < len(p.input) && p.input[end] != '"' {
+			if p.input[end] == '\n' {
+				p.line++
+			}
+			end++
+		}
+		if end >= len(p.input) {
+			return "", fmt.Errorf("line %v: unterminated string", startLine)
+		}
+		tok := string(p.input[p.pos : end+1])
+		p.pos = end + 1
+		return tok, nil
+	default:
+		end := p.pos
+		for end < len(p.input) && !unicode.IsSpace(p.input[end]) && p.input[end] != '[' && p.input[end] != ']' && p.input[end] != '"' {
+			end++
+		}
+		tok := string(p.input[p.pos:end])
+		p.pos = end
+		return tok, nil
+	}
+}
+
+// list parses key-value pairs until "]" (nested) or the end of the input
+func (p *gmlParser) list(nested bool) ([]gmlEntry, error) {
+	var entries []gmlEntry
+	for {
+		key, err := p.token()
+		if err != nil {
+			return nil, err
+		}
+		switch key {
+		case "":
+			if nested {
+				return nil, fmt.Errorf("line %v: missing ]", p.line)
+			}
+			return entries, nil
+		case "]":
+			if !nested {
+				return nil, fmt.Errorf("line %v: unexpected ]", p.line)
+			}
+			return entries, nil
+		case "[":
+			return nil, fmt.Errorf("line %v: unexpected [, expected a key", p.line)
+		}
+
+		line := p.line
+		val, err := p.token()
+		if err != nil {
+			return nil, err
+		}
+		switch val {
+		case "", "]":
+			return nil, fmt.Errorf("line %v: key %v has no value", line, key)
+		case "[":
+			sub, err := p.list(true)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, gmlEntry{key: key, value: gmlValue{list: sub, line: line}})
+		default:
+			entries = append(entries, gmlEntry{key: key, value: gmlValue{flat: strings.Trim(val, `"`), line: line}})
+		}
+	}
+}
+
+var gmlLabel = regexp.MustCompile(`^\s*\{(.*?)\}\s*\{(.*)\}\s*$`)
+
+type gmlNode struct {
+	id   int
+	line int
+	node lib.Node
+}
+
+// ParseGML rebuilds a decomposition of graph from the GML written by Decomp.ToGML.
+// Names in the labels are resolved through the encoding of the parsed graph.
+func ParseGML(input string, graph Graph, encoding map[string]int) (Decomp, error) {
+	p := &gmlParser{input: []rune(input), line: 1}
+	top, err := p.list(false)
+	if err != nil {
+		return Decomp{}, err
+	}
+	var graphEntry *gmlEntry
+	for i := range top {
+		if top[i].key == "graph" {
+			if graphEntry != nil {
+				return Decomp{}, fmt.Errorf("line %v: more than one graph", top[i].value.line)
+			}
+			graphEntry = &top[i]
+		}
+	}
+	if graphEntry == nil {
+		return Decomp{}, fmt.Errorf("no graph found")
+	}
+	if graphEntry.value.flat != "" {
+		return Decomp{}, fmt.Errorf("line %v: graph is not a list", graphEntry.value.line)
+	}
+
+	edges := make(map[int]lib.Edge)
+	for _, e := range graph.Edges.Slice() {
+		edges[e.Name] = e
+	}
+	vertices := make(map[int]bool)
+	for _, v := range graph.Edges.Vertices() {
+		vertices[v] = true
+	}
+
+	var nodes []*gmlNode
+	byID := make(map[int]*gmlNode)
+	parent := make(map[int]int)
+	children := make(map[int][]int)
+	for _, entry := range graphEntry.value.list {
+		switch entry.key {
+		case "node":
+			n, err := parseGMLNode(entry.value, edges, vertices, encoding)
+			if err != nil {
+				return Decomp{}, err
+			}
+			if _, ok := byID[n.id]; ok {
+				return Decomp{}, fmt.Errorf("line %v: node id %v is not unique", n.line, n.id)
+			}
+			byID[n.id] = n
+			nodes = append(nodes, n)
+		case "edge":
+			source, err := gmlInt(entry.value, "source")
+			if err != nil {
+				return Decomp{}, err
+			}
+			target, err := gmlInt(entry.value, "target")
+			if err != nil {
+				return Decomp{}, err
+			}
+			if par, ok := parent[target]; ok {
+				return Decomp{}, fmt.Errorf("line %v: node %v has two parents, %v and %v", entry.value.line, target, par, source)
+			}
+			parent[target] = source
+			children[source] = append(children[source], target)
+		}
+	}
+
+	if len(nodes) == 0 {
+		return Decomp{}, fmt.Errorf("the graph has no nodes")
+	}
+	for target, source := range parent {
+		if _, ok := byID[source]; !ok {
+			return Decomp{}, fmt.Errorf("edge %v -> %v: node %v does not exist", source, target, source)
+		}
+		if _, ok := byID[target]; !ok {
+			return Decomp{}, fmt.Errorf("edge %v -> %v: node %v does not exist", source, target, target)
+		}
+	}
+	var root *gmlNode
+	for _, n := range nodes {
+		if _, ok := parent[n.id]; !ok {
+			if root != nil {
+				return Decomp{}, fmt.Errorf("the decomposition is not a tree, nodes %v and %v are both roots", root.id, n.id)
+			}
+			root = n
+		}
+	}
+	if root == nil {
+		return Decomp{}, fmt.Errorf("the decomposition is not a tree, it has no root")
+	}
+
+	visited := make(map[int]bool)
+	var build func(id int) lib.Node
+	build = func(id int) lib.Node {
+		visited[id] = true
+		n := byID[id].node
+		for _, c := range children[id] {
+			n.Children = append(n.Children, build(c))
+		}
+		return n
+	}
+	res := Decomp{Graph: graph, Root: build(root.id)}
+	if len(visited) != len(nodes) { // the nodes not reached from the root lie on cycles
+		for _, n := range nodes {
+			if !visited[n.id] {
+				return Decomp{}, fmt.Errorf("the decomposition is not a tree, node %v is on a cycle", n.id)
+			}
+		}
+	}
+	return res, nil
+}
+
+func gmlInt(val gmlValue, key string) (int, error) {
+	for _, e := range val.list {
+		if e.key == key {
+			i, err := strconv.Atoi(e.value.flat)
+			if err != nil {
+				return 0, fmt.Errorf("line %v: %v %q is not an int", e.value.line, key, e.value.flat)
+			}
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("line %v: %v is missing", val.line, key)
+}
+
+func parseGMLNode(val gmlValue, edges map[int]lib.Edge, vertices map[int]bool, encoding map[string]int) (*gmlNode, error) {
+	id, err := gmlInt(val, "id")
+	if err != nil {
+		return nil, err
+	}
+	n := &gmlNode{id: id, line: val.line}
+
+	var label string
+	found := false
+	for _, e := range val.list {
+		if e.key == "label" {
+			label, found = e.value.flat, true
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("line %v: node %v has no label", val.line, id)
+	}
+	match := gmlLabel.FindStringSubmatch(label)
+	if match == nil {
+		return nil, fmt.Errorf("line %v: label %q of node %v is not {cover} {bag}", val.line, label, id)
+	}
+
+	var cover []lib.Edge
+	for _, name := range splitNames(match[1]) {
+		i, ok := encoding[name]
+		if !ok {
+			return nil, fmt.Errorf("line %v: node %v covers unknown edge %v", val.line, id, name)
+		}
+		e, ok := edges[i]
+		if !ok {
+			return nil, fmt.Errorf("line %v: node %v covers %v, which is not an edge", val.line, id, name)
+		}
+		cover = append(cover, e)
+	}
+	for _, name := range splitNames(match[2]) {
+		v, ok := encoding[name]
+		if !ok || !vertices[v] {
+			return nil, fmt.Errorf("line %v: node %v has unknown vertex %v in its bag", val.line, id, name)
+		}
+		n.node.Bag = append(n.node.Bag, v)
+	}
+	n.node.Cover = lib.NewEdges(cover)
+	return n, nil
+}
+
+func splitNames(s string) []string {
+	var res []string
+	for _, name := range strings.Split(s, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			res = append(res, name)
+		}
+	}
+	return res
+}
@@ -0,0 +1,61 @@
+package decomp
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/cem-okulmus/BalancedGo/lib"
+)
+
+func TestParseGMLRoundTrip(t *testing.T) {
+	hg, parsed := lib.GetGraph("a(X,Y), b(Y,Z), c(Z,W).")
+	d := &DetKStreamer{K: 1, Graph: hg}
+	decomps, _ := d.Stream(context.Background())
+	for dec := range decomps {
+		out, err := ParseGML(dec.ToGML(), hg, parsed.Encoding)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != dec.String() {
+			t.Errorf("parsed %v, want %v", out, dec)
+		}
+		if !out.Correct(hg) {
+			t.Errorf("parsed decomposition is not correct")
+		}
+	}
+}
+
+func TestParseGMLErrors(t *testing.T) {
+	hg, parsed := lib.GetGraph("a(X,Y), b(Y,Z), c(Z,W).")
+	node := func(id int, label string) string {
+		return "node [ id " + strconv.Itoa(id) + " label \"" + label + "\" ]\n"
+	}
+	edge := func(s int, t int) string {
+		return "edge [ source " + strconv.Itoa(s) + " target " + strconv.Itoa(t) + " ]\n"
+	}
+	tests := []struct {
+		gml  string
+		want string
+	}{
+		{"graph [ " + node(1, "{a, d} {X, Y}") + "]", "unknown edge d"},
+		{"graph [ " + node(1, "{a, X} {X, Y}") + "]", "X, which is not an edge"},
+		{"graph [ " + node(1, "{a} {X, V}") + "]", "unknown vertex V"},
+		{"graph [ " + node(1, "a X Y") + "]", "is not {cover} {bag}"},
+		{"graph [ " + node(1, "{a} {X}") + node(2, "{b} {Y}") + "]", "are both roots"},
+		{"graph [ " + node(1, "{a} {X}") + node(1, "{b} {Y}") + "]", "not unique"},
+		{"graph [ " + node(1, "{a} {X}") + node(2, "{b} {Y}") + node(3, "{c} {Z}") + edge(1, 2) + edge(3, 2) + "]", "two parents"},
+		{"graph [ " + node(1, "{a} {X}") + node(2, "{b} {Y}") + node(3, "{c} {Z}") + edge(2, 3) + edge(3, 2) + "]", "cycle"},
+		{"graph [ " + node(1, "{a} {X}") + edge(1, 4) + "]", "node 4 does not exist"},
+		{"graph [ node [ label \"{a} {X}\" ] ]", "id is missing"},
+		{"graph [ " + node(1, "{a} {X}"), "missing ]"},
+		{"graph [ ]", "no nodes"},
+	}
+	for _, test := range tests {
+		_, err := ParseGML(test.gml, hg, parsed.Encoding)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("ParseGML(%q) = %v, want error containing %q", test.gml, err, test.want)
+		}
+	}
+}
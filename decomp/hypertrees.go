@@ -27,6 +27,23 @@ type SearchTree struct {
 	curr *SearchNode
 }
 
+// components returns the components of hg without sep, ordered by their first
+// edge, since GetComponents returns them in random order
+func components(hg Graph, sep lib.Edges) []Graph {
+	comps, _, _ := hg.GetComponents(sep)
+	sort.SliceStable(comps, func(i, j int) bool {
+		return firstEdge(comps[i]) < firstEdge(comps[j])
+	})
+	return comps
+}
+
+func firstEdge(hg Graph) int {
+	if hg.Edges.Len() == 0 {
+		return -1
+	}
+	return hg.Edges.Slice()[0].Name
+}
+
 func (tree *SearchTree) MakeChild(hg Graph, sepGen *DetKSeparatorIt) *SearchNode {
 	n := &SearchNode{hg: hg, sepGen: sepGen}
 	n.parent = tree.curr
@@ -49,6 +66,21 @@ func (tree *SearchTree) RemoveChildren() {
 	// TODO clean n, no memory waste
 }
 
+// RemoveChild removes the current node, the last child of its parent, and
+// moves to the parent
+func (tree *SearchTree) RemoveChild() {
+	n := tree.curr
+	tree.curr = n.parent
+	if tree.curr == nil {
+		tree.root = nil
+	} else if last := len(tree.curr.children) - 1; tree.curr.children[last] == n {
+		tree.curr.children[last] = nil
+		tree.curr.children = tree.curr.children[:last]
+	} else {
+		panic("the current node is not the last child")
+	}
+}
+
 func (tree *SearchTree) MoveToParent() {
 	tree.curr = tree.curr.parent
 }
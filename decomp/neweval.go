@@ -17,15 +17,37 @@ func (qe Evaluator) Eval(dec Decomp) int {
 }
 
 func (qe Evaluator) EvalTree(tree *SearchTree) int {
+	return qe.evalTree(tree, nil)
+}
+
+// evalTree passes each cost to visit, with a nil child for the cost of a node.
+// The stats of each node are reduced by its children bottom up, without
+// changing the StatsDB, so that evaluating a tree never affects the next one.
+// The cost of an edge is the size of the parent reduced by that child after
+// the children before it, each reduced by its own subtree, so it is at most
+// EvalEdge of the same edge.
+func (qe Evaluator) evalTree(tree *SearchTree, visit func(n *SearchNode, child *SearchNode, cost int)) int {
 	cost := 0
+	reduced := make(map[*SearchNode]*db.Statistics)
 	var n *SearchNode
 	dfs := tree.dfs()
 	for len(dfs) > 0 {
 		n, dfs = dfs[len(dfs)-1], dfs[:len(dfs)-1]
-		cost += qe.EvalNode(n)
+		nodeCost := qe.EvalNode(n)
+		if visit != nil {
+			visit(n, nil, nodeCost)
+		}
+		cost += nodeCost
+		stats, _ := qe.StatsDB.Stats(n.sep)
 		for _, child := range n.children {
-			cost += qe.EvalEdge(n, child)
+			var edgeCost int
+			edgeCost, stats = db.EstimateSemijoinSize(stats, reduced[child])
+			if visit != nil {
+				visit(n, child, edgeCost)
+			}
+			cost += edgeCost
 		}
+		reduced[n] = stats
 	}
 	return cost
 }
@@ -49,6 +71,8 @@ func (qe Evaluator) EvalNode(n *SearchNode) int {
 	return stats.Size
 }
 
+// EvalEdge estimates the size of the parent reduced by the child alone, both
+// unreduced by the rest of the tree, unlike the edge costs summed by EvalTree
 func (qe Evaluator) EvalEdge(par *SearchNode, child *SearchNode) int {
 	parStats, parOk := qe.StatsDB.Stats(par.sep)
 	childStats, childOk := qe.StatsDB.Stats(child.sep)
@@ -57,25 +81,6 @@ func (qe Evaluator) EvalEdge(par *SearchNode, child *SearchNode) int {
 		panic(fmt.Errorf("no stats for edge (%v,%v)", par.sep, child.sep))
 	}
 
-	newParSize, newParStats := db.EstimateSemijoinSize(parStats, childStats)
-	qe.StatsDB.Put(par.sep, newParStats)
+	newParSize, _ := db.EstimateSemijoinSize(parStats, childStats)
 	return newParSize
-
-	/*parTables := qe.toTables(par.sep)
-	childTables := qe.toTables(child.sep)
-	if len(par.sep.Slice()) == 1 && len(child.sep.Slice()) == 1 {
-		return db.HgramSemijoinSize(parTables[0], childTables[0])
-	} // non funziona, non tengo conto che par puo' avere altri figli*/
-
-	// size_{child} = sel_{child} * par.size
-	// sel_{child} = (expected cardinality of q_{child}) / (prod of q_{child} tables)
-	/*num := child.size * par.size
-	den := 1
-	childTables := qe.toTables(child.sep)
-	for _, t := range childTables {
-		den *= t.Size()
-	}
-	return int(math.Round(float64(num) / float64(den)))
-	// I think there are smarter ways to do this
-	*/
 }
@@ -0,0 +1,159 @@
+package decomp
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/cem-okulmus/BalancedGo/lib"
+	"github.com/dmlongo/hd-gen/db"
+)
+
+// OptDetKStreamer sends the cheapest decomposition under Ev, found by dynamic
+// programming over the subproblems of DetK, in the style of cost-k-decomp.
+// A subproblem is a component with the separator of its parent, which many
+// separators share, and it is solved once.
+//
+// The cost of an edge depends on the stats of the child reduced by its own
+// subtree, so the cheapest subtree alone may not be part of the optimum. The
+// rest of the tree only sees the reduced stats of the root of a subtree through
+// the semijoin with its parent, whose separator shares with the subproblem only
+// vertices of the connector, as the other vertices of a component are outside
+// the separator of its parent. Thus a subtree dominates another one if it is
+// not more expensive and the two have the same db.ReducerKey on the connector,
+// and a subproblem keeps a single subtree for each such key. Their number is
+// bounded by the distinct reductions of the connector, not by the subtrees of
+// the component, and the result is optimal under EvalTree, as found by
+// BestDetKStreamer.
+type OptDetKStreamer struct {
+	K     int
+	Graph lib.Graph
+	Ev    *Evaluator
+
+	memo  map[string][]*optTree
+	built int // subtrees built by the last search
+}
+
+// optTree is the cheapest subtree found with the given reduced stats of its root
+type optTree struct {
+	sep      lib.Edges
+	bag      []int
+	children []*optTree
+	cost     int
+	stats    *db.Statistics
+}
+
+func (o *OptDetKStreamer) Name() string {
+	return "OptDetK"
+}
+
+func (o *OptDetKStreamer) Stream(ctx context.Context) (<-chan Decomp, <-chan error) {
+	return stream(ctx, func(emit func(Decomp) error) error {
+		o.memo = make(map[string][]*optTree)
+		o.built = 0
+		trees, err := o.solve(ctx, o.Graph, []int{})
+		if err != nil || len(trees) == 0 {
+			return err
+		}
+		best := trees[0]
+		for _, t := range trees[1:] {
+			if t.cost < best.cost {
+				best = t
+			}
+		}
+		return emit(Decomp{Graph: o.Graph, Root: best.node()})
+	})
+}
+
+// solve returns the subtrees that decompose H below a node with bag oldSep,
+// none if H has no decomposition of width K
+func (o *OptDetKStreamer) solve(ctx context.Context, H Graph, oldSep []int) ([]*optTree, error) {
+	key := memoKey(H, oldSep)
+	if trees, ok := o.memo[key]; ok {
+		return trees, nil
+	}
+
+	var res []*optTree
+	byView := make(map[string]int)
+	inner := make(map[string]bool) // the vertices that no parent separator has
+	for _, v := range lib.Diff(H.Vertices(), oldSep) {
+		inner[strconv.Itoa(v)] = true
+	}
+	shared := func(attr string) bool { return !inner[attr] }
+	extVerts := append(H.Vertices(), oldSep...)
+	sepGen := NewDetKSepGen(H, o.K, o.Graph.Edges, oldSep)
+	for sepGen.HasNext() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		sep := sepGen.Next()
+		bag := lib.Inter(sep.Vertices(), extVerts)
+		comps := components(H, sep)
+		nodeCost := o.Ev.EvalNode(&SearchNode{sep: sep})
+		stats, _ := o.Ev.StatsDB.Stats(sep)
+
+		// reduce the node by its children in order, as EvalTree does, keeping the
+		// cheapest choice of subtrees for each distinct reduced stats
+		partial := []*optTree{{sep: sep, bag: bag, cost: nodeCost, stats: stats}}
+		for _, Hc := range comps {
+			subs, err := o.solve(ctx, Hc, bag)
+			if err != nil {
+				return nil, err
+			}
+			var next []*optTree
+			nextByStats := make(map[string]int)
+			for _, p := range partial {
+				for _, sub := range subs {
+					edgeCost, reduced := db.EstimateSemijoinSize(p.stats, sub.stats)
+					t := &optTree{sep: sep, bag: bag, cost: p.cost + sub.cost + edgeCost, stats: reduced}
+					t.children = append(append(make([]*optTree, 0, len(p.children)+1), p.children...), sub)
+					o.built++
+					next = keepCheapest(next, nextByStats, t.stats.Key(), t)
+				}
+			}
+			partial = next
+		}
+		if len(comps) == 0 {
+			o.built++
+		}
+		for _, t := range partial {
+			res = keepCheapest(res, byView, t.stats.ReducerKey(shared), t)
+		}
+	}
+	o.memo[key] = res
+	return res, nil
+}
+
+// keepCheapest adds t to trees, unless one with the same key is not more expensive.
+// The children of a node still to reduce it see all of its stats, so partial
+// nodes are kept by Statistics.Key instead.
+func keepCheapest(trees []*optTree, byKey map[string]int, k string, t *optTree) []*optTree {
+	if i, ok := byKey[k]; !ok {
+		byKey[k] = len(trees)
+		trees = append(trees, t)
+	} else if t.cost < trees[i].cost {
+		trees[i] = t
+	}
+	return trees
+}
+
+// memoKey identifies a subproblem by the names of its edges and its connector
+func memoKey(H Graph, oldSep []int) string {
+	edges := make([]int, 0, H.Edges.Len())
+	for _, e := range H.Edges.Slice() {
+		edges = append(edges, e.Name)
+	}
+	sort.Ints(edges)
+	conn := append([]int(nil), oldSep...)
+	sort.Ints(conn)
+	return fmt.Sprint(edges, conn)
+}
+
+func (t *optTree) node() lib.Node {
+	n := lib.Node{Bag: t.bag, Cover: t.sep}
+	for _, c := range t.children {
+		n.Children = append(n.Children, c.node())
+	}
+	return n
+}
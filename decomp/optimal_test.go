@@ -0,0 +1,100 @@
+package decomp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/cem-okulmus/BalancedGo/lib"
+)
+
+func TestOptDetKStream(t *testing.T) {
+	tests := []struct {
+		graph string
+		stats string
+	}{
+		{"a(X,Y), b(Y,Z), c(Z,W).", pathStats},
+		{"a(X,Y), b(Y,Z), c(Z,W), d(W,V).", pathStats + "size,d,7\nndv,d,W,3\nndv,d,V,7\n"},
+		{"a(X,Y), b(X,Z), c(X,W).", "size,a,30\nsize,b,8\nsize,c,12\nndv,a,X,6\nndv,a,Y,30\n" +
+			"ndv,b,X,8\nndv,b,Z,2\nndv,c,X,3\nndv,c,W,12\n"},
+	}
+	for _, tt := range tests {
+		hg, parsed := lib.GetGraph(tt.graph)
+		ev := testEvaluator(t, hg, parsed.Encoding, tt.stats)
+
+		for k := 1; k <= 2; k++ {
+			var decs []Decomp
+			decomps, errc := (&OptDetKStreamer{K: k, Graph: hg, Ev: ev}).Stream(context.Background())
+			for dec := range decomps {
+				decs = append(decs, dec)
+			}
+			if err := <-errc; err != nil {
+				t.Fatalf("%v k=%v: search ended with %v", tt.graph, k, err)
+			}
+			if len(decs) != 1 {
+				t.Fatalf("%v k=%v: %v decompositions, want 1", tt.graph, k, len(decs))
+			}
+			if !decs[0].Correct(hg) {
+				t.Errorf("%v k=%v: decomposition %v is not correct", tt.graph, k, decs[0])
+			}
+			got := ev.Eval(decs[0])
+
+			want := -1
+			best := &BestDetKStreamer{DetK: &DetKStreamer{K: k, Graph: hg}, Ev: ev}
+			decomps, errc = best.Stream(context.Background())
+			for dec := range decomps {
+				want = ev.Eval(dec)
+			}
+			if err := <-errc; err != nil {
+				t.Fatal(err)
+			}
+			if got != want {
+				t.Errorf("%v k=%v: cost %v, want the optimum %v", tt.graph, k, got, want)
+			}
+			if bnb := bnbCosts(t, hg, k, ev); bnb != want {
+				t.Errorf("%v k=%v: bnb cost %v, want the optimum %v", tt.graph, k, bnb, want)
+			}
+		}
+	}
+}
+
+func TestOptDetKStreamLargerGraph(t *testing.T) {
+	hg, parsed := lib.GetGraph("a(X,Y), b(Y,Z), c(Z,W), d(W,V), e(V,U), f(U,T), g(T,S), h(S,R).")
+	names := Names(parsed.Encoding)
+	var stats strings.Builder
+	for i, e := range hg.Edges.Slice() {
+		size := 5 + 7*i%23
+		fmt.Fprintf(&stats, "size,%v,%v\n", names[e.Name], size)
+		for j, v := range e.Vertices {
+			fmt.Fprintf(&stats, "ndv,%v,%v,%v\n", names[e.Name], names[v], 1+(3*i+j)%size)
+		}
+	}
+	ev := testEvaluator(t, hg, parsed.Encoding, stats.String())
+
+	k := 2
+	opt := &OptDetKStreamer{K: k, Graph: hg, Ev: ev}
+	got := -1
+	decomps, errc := opt.Stream(context.Background())
+	for dec := range decomps {
+		got = ev.Eval(dec)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if want := bnbCosts(t, hg, k, ev); got != want {
+		t.Errorf("cost %v, want the optimum %v", got, want)
+	}
+
+	n := 0
+	decomps, errc = (&DetKStreamer{K: k, Graph: hg}).Stream(context.Background())
+	for range decomps {
+		n++
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if opt.built >= n {
+		t.Errorf("built %v subtrees, want fewer than the %v decompositions", opt.built, n)
+	}
+}
@@ -0,0 +1,156 @@
+package decomp
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/cem-okulmus/BalancedGo/lib"
+)
+
+// Names inverts the encoding of a parsed graph
+func Names(encoding map[string]int) map[int]string {
+	res := make(map[int]string, len(encoding))
+	for s, i := range encoding {
+		res[i] = s
+	}
+	return res
+}
+
+// ToTD exports dec in the PACE 2016/2019 tree decomposition format.
+// Vertices are numbered from 1 in the order of their encoding, bags from 1
+// in the node order of MakeDecomp. Vertices not in dec.Graph, like the ones
+// added by MakeEdgesDistinct, are left out. If names is not nil, comments
+// map the numbers back to the names of the vertices.
+func ToTD(dec Decomp, names map[int]string) string {
+	p := newPaceExport(dec)
+	var buffer bytes.Buffer
+	p.comments(&buffer, names, false)
+	maxBag := 0
+	for _, n := range p.nodes {
+		if size := len(p.bag(n)); size > maxBag {
+			maxBag = size
+		}
+	}
+	fmt.Fprintf(&buffer, "s td %v %v %v\n", len(p.nodes), maxBag, len(p.vertices))
+	p.bags(&buffer)
+	p.treeEdges(&buffer)
+	return buffer.String()
+}
+
+// ToHTD exports dec in the PACE 2019 hypertree decomposition format, that is
+// the tree decomposition format with a w line for each bag and hyperedge.
+// Hyperedges are numbered from 1 in the order of dec.Graph.Edges.
+func ToHTD(dec Decomp, names map[int]string) string {
+	p := newPaceExport(dec)
+	var buffer bytes.Buffer
+	p.comments(&buffer, names, true)
+	width := 0
+	for _, n := range p.nodes {
+		if n.Cover.Len() > width {
+			width = n.Cover.Len()
+		}
+	}
+	fmt.Fprintf(&buffer, "s htd %v %v %v %v\n", len(p.nodes), width, len(p.vertices), len(p.edges))
+	p.bags(&buffer)
+	for i, n := range p.nodes {
+		inCover := make(map[int]bool)
+		for _, e := range n.Cover.Slice() {
+			inCover[e.Name] = true
+		}
+		for j, e := range dec.Graph.Edges.Slice() {
+			weight := 0
+			if inCover[e.Name] {
+				weight = 1
+			}
+			fmt.Fprintf(&buffer, "w %v %v %v\n", i+1, j+1, weight)
+		}
+	}
+	p.treeEdges(&buffer)
+	return buffer.String()
+}
+
+type paceExport struct {
+	nodes    []*lib.Node // in the order of MakeDecomp
+	parents  []int       // index of the parent of each node, -1 for the root
+	vertices map[int]int // vertex => PACE number
+	edges    map[int]int // edge => PACE number
+}
+
+func newPaceExport(dec Decomp) *paceExport {
+	p := &paceExport{vertices: make(map[int]int), edges: make(map[int]int)}
+	var visit func(n *lib.Node, parent int)
+	visit = func(n *lib.Node, parent int) {
+		me := len(p.nodes)
+		p.nodes = append(p.nodes, n)
+		p.parents = append(p.parents, parent)
+		for i := range n.Children {
+			visit(&n.Children[i], me)
+		}
+	}
+	visit(&dec.Root, -1)
+
+	vertices := append([]int(nil), dec.Graph.Vertices()...)
+	sort.Ints(vertices)
+	for i, v := range vertices {
+		p.vertices[v] = i + 1
+	}
+	for i, e := range dec.Graph.Edges.Slice() {
+		p.edges[e.Name] = i + 1
+	}
+	return p
+}
+
+// bag returns the PACE numbers of the vertices in the bag of n
+func (p *paceExport) bag(n *lib.Node) []int {
+	var res []int
+	for _, v := range n.Bag {
+		if num, ok := p.vertices[v]; ok {
+			res = append(res, num)
+		}
+	}
+	sort.Ints(res)
+	return res
+}
+
+func (p *paceExport) comments(buffer *bytes.Buffer, names map[int]string, withEdges bool) {
+	if names == nil {
+		return
+	}
+	for _, v := range sortedKeys(p.vertices) {
+		fmt.Fprintf(buffer, "c vertex %v %v\n", p.vertices[v], names[v])
+	}
+	if withEdges {
+		for _, e := range sortedKeys(p.edges) {
+			fmt.Fprintf(buffer, "c edge %v %v\n", p.edges[e], names[e])
+		}
+	}
+}
+
+func (p *paceExport) bags(buffer *bytes.Buffer) {
+	for i, n := range p.nodes {
+		fmt.Fprintf(buffer, "b %v", i+1)
+		for _, v := range p.bag(n) {
+			fmt.Fprintf(buffer, " %v", v)
+		}
+		buffer.WriteString("\n")
+	}
+}
+
+func (p *paceExport) treeEdges(buffer *bytes.Buffer) {
+	for i, par := range p.parents {
+		if par >= 0 {
+			fmt.Fprintf(buffer, "%v %v\n", par+1, i+1)
+		}
+	}
+}
+
+// sortedKeys sorts the keys of m by their values
+func sortedKeys(m map[int]int) []int {
+	res := make([]int, 0, len(m))
+	for k := range m {
+		res = append(res, k)
+	}
+	sort.Slice(res, func(i, j int) bool { return m[res[i]] < m[res[j]] })
+	return res
+}
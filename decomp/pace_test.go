@@ -0,0 +1,56 @@
+package decomp
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cem-okulmus/BalancedGo/lib"
+)
+
+const paceGML = `graph [
+  node [ id 1 label "{b} {Y, Z}" ]
+  node [ id 2 label "{a} {X, Y}" ]
+  node [ id 3 label "{c} {Z, W}" ]
+  edge [ source 1 target 2 ]
+  edge [ source 1 target 3 ]
+]`
+
+func TestToTD(t *testing.T) {
+	hg, parsed := lib.GetGraph("a(X,Y), b(Y,Z), c(Z,W).")
+	dec, err := ParseGML(paceGML, hg, parsed.Encoding)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "s td 3 2 4\nb 1 2 3\nb 2 1 2\nb 3 3 4\n1 2\n1 3\n"
+	if got := ToTD(dec, nil); got != want {
+		t.Errorf("got\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestToTDComplete(t *testing.T) {
+	hg, parsed := lib.GetGraph("a(X,Y), b(Y,Z), c(Z,W).")
+	dec, err := ParseGML(paceGML, hg, parsed.Encoding)
+	if err != nil {
+		t.Fatal(err)
+	}
+	completed := hg
+	added := completed.MakeEdgesDistinct()
+	dec.Root.Bag = append(dec.Root.Bag, added...) // left over by -complete
+	if got, want := ToTD(dec, nil), "b 1 2 3\n"; !strings.Contains(got, want) {
+		t.Errorf("added vertices were exported:\n%v", got)
+	}
+}
+
+func TestToHTD(t *testing.T) {
+	hg, parsed := lib.GetGraph("a(X,Y), b(Y,Z), c(Z,W).")
+	dec, err := ParseGML(paceGML, hg, parsed.Encoding)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := ToHTD(dec, Names(parsed.Encoding))
+	for _, want := range []string{"c vertex 1 X\n", "c edge 3 c\n", "s htd 3 1 4 3\n", "w 1 2 1\nw 1 3 0\n", "w 3 3 1\n"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("%q missing in\n%v", want, got)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package decomp
+
+import (
+	"container/heap"
+	"context"
+
+	"github.com/cem-okulmus/BalancedGo/lib"
+)
+
+// RankedDetKStreamer sends the decompositions of DetKStreamer in nondecreasing
+// cost under Ev. It expands the cheapest partial decomposition first, so it
+// only explores the decompositions up to the cost of the last one sent.
+//
+// A separator is only used if its components can be decomposed, as decided
+// once for each of them with the cache of DetK, so every partial decomposition
+// in the queue can be completed and failing components are never expanded
+// again. The queue still holds every partial decomposition cheaper than the
+// next one sent, so its memory grows with the decompositions of that cost.
+type RankedDetKStreamer struct {
+	K     int
+	Graph lib.Graph
+	Ev    *Evaluator
+
+	cache  lib.Cache
+	queued int // partial decompositions queued by the last search
+}
+
+func (r *RankedDetKStreamer) Name() string {
+	return "RankedDetK"
+}
+
+// rankNode is a node of a partial decomposition, with the index of its parent
+type rankNode struct {
+	sep    lib.Edges
+	bag    []int
+	parent int
+}
+
+// rankComp is a component still to decompose below the node parent
+type rankComp struct {
+	hg     Graph
+	parent int
+}
+
+// rankState is a partial decomposition, with the sum of the costs of its nodes
+// as a lower bound, or a complete one with its exact cost
+type rankState struct {
+	nodes []rankNode
+	open  []rankComp // a stack, to decompose the components in order
+	cost  int
+	seq   int // order of creation, to break ties deterministically
+}
+
+func (s *rankState) complete() bool {
+	return len(s.open) == 0
+}
+
+type rankQueue []*rankState
+
+func (q rankQueue) Len() int { return len(q) }
+func (q rankQueue) Less(i, j int) bool {
+	if q[i].cost != q[j].cost {
+		return q[i].cost < q[j].cost
+	}
+	if q[i].complete() != q[j].complete() {
+		return q[i].complete()
+	}
+	return q[i].seq < q[j].seq
+}
+func (q rankQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *rankQueue) Push(x interface{}) { *q = append(*q, x.(*rankState)) }
+func (q *rankQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	x := old[n-1]
+	old[n-1] = nil
+	*q = old[:n-1]
+	return x
+}
+
+func (r *RankedDetKStreamer) Stream(ctx context.Context) (<-chan Decomp, <-chan error) {
+	return stream(ctx, func(emit func(Decomp) error) error {
+		r.cache.Init()
+		r.queued = 0
+		seq := 0
+		q := &rankQueue{{open: []rankComp{{hg: r.Graph, parent: -1}}}}
+		for q.Len() > 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			s := heap.Pop(q).(*rankState)
+			if s.complete() {
+				if err := emit(MakeDecomp(*s.tree(r.Graph))); err != nil {
+					return err
+				}
+				continue
+			}
+			for _, next := range r.expand(ctx, s) {
+				seq++
+				next.seq = seq
+				if !next.complete() {
+					r.queued++
+				}
+				heap.Push(q, next)
+			}
+		}
+		return nil
+	})
+}
+
+// expand decomposes the next open component of s with each of its separators
+// whose components can be decomposed. Edge costs are never negative, so the
+// cost of the nodes is a lower bound until the decomposition is complete and
+// EvalTree gives its exact cost.
+func (r *RankedDetKStreamer) expand(ctx context.Context, s *rankState) []*rankState {
+	c := s.open[len(s.open)-1]
+	var oldSep []int
+	if c.parent >= 0 {
+		oldSep = s.nodes[c.parent].bag
+	}
+	extVerts := append(c.hg.Vertices(), oldSep...)
+	sepGen := NewDetKSepGen(c.hg, r.K, r.Graph.Edges, oldSep)
+
+	var res []*rankState
+	for sepGen.HasNext() {
+		sep := sepGen.Next()
+		n := rankNode{sep: sep, bag: lib.Inter(sep.Vertices(), extVerts), parent: c.parent}
+		comps := components(c.hg, sep)
+		if !r.decomposable(ctx, sep, n.bag, comps) {
+			continue
+		}
+
+		next := &rankState{cost: s.cost + r.Ev.EvalNode(&SearchNode{sep: sep})}
+		next.nodes = append(append(make([]rankNode, 0, len(s.nodes)+1), s.nodes...), n)
+		next.open = append([]rankComp(nil), s.open[:len(s.open)-1]...)
+		for i := len(comps) - 1; i >= 0; i-- {
+			next.open = append(next.open, rankComp{hg: comps[i], parent: len(s.nodes)})
+		}
+		if next.complete() {
+			next.cost = r.Ev.EvalTree(next.tree(r.Graph))
+		}
+		res = append(res, next)
+	}
+	return res
+}
+
+// decomposable tells whether each of the components of sep, a separator with
+// the given bag, has a decomposition below it. The answers are cached, like
+// the failures of DetK, so each component is decided once.
+func (r *RankedDetKStreamer) decomposable(ctx context.Context, sep lib.Edges, bag []int, comps []Graph) bool {
+	for _, Hc := range comps {
+		if r.cache.CheckNegative(sep, []Graph{Hc}) {
+			return false
+		}
+		if r.cache.CheckPositive(sep, []Graph{Hc}) {
+			continue
+		}
+		found := false
+		extVerts := append(Hc.Vertices(), bag...)
+		sepGen := NewDetKSepGen(Hc, r.K, r.Graph.Edges, bag)
+		for !found && ctx.Err() == nil && sepGen.HasNext() {
+			child := sepGen.Next()
+			found = r.decomposable(ctx, child, lib.Inter(child.Vertices(), extVerts), components(Hc, child))
+		}
+		if ctx.Err() != nil {
+			return false // undecided, so not cached
+		}
+		if !found {
+			r.cache.AddNegative(sep, Hc)
+			return false
+		}
+		r.cache.AddPositive(sep, Hc)
+	}
+	return true
+}
+
+// tree builds the search tree of the nodes of s, children in order of creation
+func (s *rankState) tree(hg Graph) *SearchTree {
+	nodes := make([]*SearchNode, len(s.nodes))
+	for i, n := range s.nodes {
+		nodes[i] = &SearchNode{sep: n.sep, bag: n.bag}
+		if n.parent >= 0 {
+			par := nodes[n.parent]
+			nodes[i].parent = par
+			par.children = append(par.children, nodes[i])
+		}
+	}
+	nodes[0].hg = hg
+	return &SearchTree{root: nodes[0]}
+}
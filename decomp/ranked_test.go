@@ -0,0 +1,110 @@
+package decomp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/cem-okulmus/BalancedGo/lib"
+)
+
+func TestRankedDetKStream(t *testing.T) {
+	hg, parsed := lib.GetGraph("a(X,Y), b(Y,Z), c(Z,W).")
+	ev := testEvaluator(t, hg, parsed.Encoding, pathStats)
+
+	for k := 1; k <= 2; k++ {
+		var want []int
+		decomps, errc := (&DetKStreamer{K: k, Graph: hg}).Stream(context.Background())
+		for dec := range decomps {
+			want = append(want, ev.Eval(dec))
+		}
+		if err := <-errc; err != nil {
+			t.Fatal(err)
+		}
+		sort.Ints(want)
+
+		var costs []int
+		seen := make(map[string]bool)
+		decomps, errc = (&RankedDetKStreamer{K: k, Graph: hg, Ev: ev}).Stream(context.Background())
+		for dec := range decomps {
+			if !dec.Correct(hg) {
+				t.Errorf("k=%v: decomposition %v is not correct", k, dec)
+			}
+			if seen[dec.String()] {
+				t.Errorf("k=%v: decomposition %v sent twice", k, dec)
+			}
+			seen[dec.String()] = true
+			costs = append(costs, ev.Eval(dec))
+		}
+		if err := <-errc; err != nil {
+			t.Errorf("k=%v: complete search ended with %v", k, err)
+		}
+		if !sort.IntsAreSorted(costs) {
+			t.Errorf("k=%v: costs %v are not in nondecreasing order", k, costs)
+		}
+		if !equalInts(costs, want) {
+			t.Errorf("k=%v: costs %v, want those of DetK %v", k, costs, want)
+		}
+		if best := bnbCosts(t, hg, k, ev); len(costs) == 0 || costs[0] != best {
+			t.Errorf("k=%v: costs %v, want the optimum %v first", k, costs, best)
+		}
+	}
+}
+
+func TestRankedDetKStreamCancel(t *testing.T) {
+	hg, parsed := lib.GetGraph("a(X,Y), b(Y,Z), c(Z,W).")
+	ev := testEvaluator(t, hg, parsed.Encoding, pathStats)
+	ctx, cancel := context.WithCancel(context.Background())
+	decomps, errc := (&RankedDetKStreamer{K: 2, Graph: hg, Ev: ev}).Stream(ctx)
+	if _, ok := <-decomps; !ok {
+		t.Fatal("no decomposition found")
+	}
+	cancel()
+	for range decomps {
+	}
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled search ended with %v", err)
+	}
+}
+
+// A graph without decompositions of width K fails at the root, rather than
+// expanding its partial decompositions until they get stuck
+func TestRankedDetKStreamNoDecomp(t *testing.T) {
+	hg, parsed := lib.GetGraph("a(X,Y), b(Y,Z), c(Z,W), d(W,V), e(V,U), f(U,X).")
+	var stats strings.Builder
+	for _, e := range hg.Edges.Slice() {
+		name := Names(parsed.Encoding)[e.Name]
+		fmt.Fprintf(&stats, "size,%v,10\n", name)
+		for _, v := range e.Vertices {
+			fmt.Fprintf(&stats, "ndv,%v,%v,3\n", name, Names(parsed.Encoding)[v])
+		}
+	}
+	ev := testEvaluator(t, hg, parsed.Encoding, stats.String())
+
+	r := &RankedDetKStreamer{K: 1, Graph: hg, Ev: ev}
+	decomps, errc := r.Stream(context.Background())
+	for dec := range decomps {
+		t.Errorf("decomposition %v of width 1 of a cycle", dec)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if r.queued != 0 {
+		t.Errorf("queued %v partial decompositions, want none", r.queued)
+	}
+}
+
+func equalInts(a []int, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -1,128 +1,235 @@
 package decomp
 
 import (
+	"context"
 	"fmt"
+	"sync"
+	"sync/atomic"
 
 	"github.com/cem-okulmus/BalancedGo/lib"
 )
 
+// Streamer enumerates decompositions of a hypergraph
 type Streamer interface {
 	Name() string
-	Stream(stop <-chan bool) <-chan Decomp
+	// Stream sends decompositions until the search ends or ctx is done.
+	// Once the first channel is closed, the second one delivers why the
+	// stream ended: nil if the search was complete, ctx.Err() if it was
+	// cancelled, or the error that made the search fail.
+	Stream(ctx context.Context) (<-chan Decomp, <-chan error)
+}
+
+// stream runs search on its own goroutine, converting its panics into errors.
+// The emit function given to search fails with ctx.Err() once ctx is done.
+func stream(ctx context.Context, search func(emit func(Decomp) error) error) (<-chan Decomp, <-chan error) {
+	out := make(chan Decomp)
+	errc := make(chan error, 1)
+	go func() {
+		var err error
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("search failed: %v", r)
+			}
+			close(out)
+			errc <- err
+			close(errc)
+		}()
+
+		err = search(func(dec Decomp) error {
+			select {
+			case out <- dec:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	}()
+	return out, errc
 }
 
 type DetKStreamer struct {
 	K     int
 	Graph lib.Graph
-	sTree SearchTree
+	// Workers bounds the goroutines decomposing sibling components at once,
+	// which are independent subproblems. The search is sequential if Workers
+	// is at most 1, and the decompositions are the same in either case.
+	Workers int
+	sTree   SearchTree
 
-	cache lib.Cache
+	cache lib.Cache     // safe for concurrent use
+	sem   chan struct{} // a token for each worker besides the current goroutine
 }
 
 func (d *DetKStreamer) Name() string {
 	return "EnumDetK"
 }
 
-func (d *DetKStreamer) Stream(stop <-chan bool) <-chan Decomp {
-	out := make(chan Decomp)
-	go func() {
-		defer close(out)
-
+func (d *DetKStreamer) Stream(ctx context.Context) (<-chan Decomp, <-chan error) {
+	return stream(ctx, func(emit func(Decomp) error) error {
 		d.cache.Init()
-		if d.decompose(d.Graph, []int{}) {
-			select {
-			case out <- MakeDecomp(d.sTree):
-			case <-stop:
-				return
+		d.sem = nil
+		if d.Workers > 1 {
+			d.sem = make(chan struct{}, d.Workers-1)
+		}
+		if d.decompose(ctx, &d.sTree, d.Graph, []int{}) {
+			if err := emit(MakeDecomp(d.sTree)); err != nil {
+				return err
 			}
 		}
-		for d.advance() {
-			select {
-			case out <- MakeDecomp(d.sTree):
-			case <-stop:
-				return
+		for {
+			found, err := d.advance(ctx)
+			if err != nil {
+				return err
+			}
+			if !found {
+				break
+			}
+			if err := emit(MakeDecomp(d.sTree)); err != nil {
+				return err
 			}
 		}
-	}()
-	return out
+		return ctx.Err()
+	})
 }
 
-func (d *DetKStreamer) decompose(H Graph, oldSep []int) bool {
+// decompose gives up as soon as ctx is done
+func (d *DetKStreamer) decompose(ctx context.Context, tree *SearchTree, H Graph, oldSep []int) bool {
 	sepGen := NewDetKSepGen(H, d.K, d.Graph.Edges, oldSep)
-	n := d.sTree.MakeChild(H, sepGen)
+	n := tree.MakeChild(H, sepGen)
 	n.extVerts = append(H.Vertices(), oldSep...)
-	found := false
-	for n.sepGen.HasNext() {
+	found := d.nextSep(ctx, tree, n)
+	if found {
+		tree.MoveToParent()
+	} else {
+		tree.RemoveChildren()
+	}
+	return found
+}
+
+// nextSep moves n, the current node of tree, to its next separator whose
+// components can all be decomposed, false if there is none
+func (d *DetKStreamer) nextSep(ctx context.Context, tree *SearchTree, n *SearchNode) bool {
+	for ctx.Err() == nil && n.sepGen.HasNext() {
 		n.sep = n.sepGen.Next()
 		n.bag = lib.Inter(n.sep.Vertices(), n.extVerts)
-		n.myComps, _, _ = H.GetComponents(n.sep)
+		n.myComps = components(n.hg, n.sep)
 		if len(n.myComps) == 0 {
-			found = true
-			break
+			return true
 		}
 		if d.cache.CheckNegative(n.sep, n.myComps) {
-			break
+			continue
 		}
-		allSubDecomp := true
-		for _, Hc := range n.myComps {
-			allSubDecomp = d.decompose(Hc, n.bag)
-			if !allSubDecomp {
+		if d.decomposeComps(ctx, tree, n) {
+			return true
+		}
+	}
+	return false
+}
+
+// decomposeComps decomposes the components of n below it, one after the
+// other, or concurrently if there are workers
+func (d *DetKStreamer) decomposeComps(ctx context.Context, tree *SearchTree, n *SearchNode) bool {
+	if d.sem != nil && len(n.myComps) > 1 {
+		return d.decomposeParallel(ctx, n)
+	}
+	for _, Hc := range n.myComps {
+		if !d.decompose(ctx, tree, Hc, n.bag) {
+			if ctx.Err() == nil {
 				d.cache.AddNegative(n.sep, Hc)
-				break
 			}
+			return false
 		}
-		if allSubDecomp {
-			found = true
-			break
+	}
+	return true
+}
+
+// decomposeParallel decomposes each component of n in a tree of its own, on a
+// new goroutine if a worker is free, and attaches the trees to n in the order
+// of the components. The first component that fails stops the others.
+func (d *DetKStreamer) decomposeParallel(ctx context.Context, n *SearchNode) bool {
+	sctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	roots := make([]*SearchNode, len(n.myComps))
+	failed := make([]bool, len(n.myComps))
+	panics := make([]interface{}, len(n.myComps))
+	var wg sync.WaitGroup
+	for i, Hc := range n.myComps {
+		i, Hc := i, Hc
+		solve := func() {
+			defer func() {
+				if r := recover(); r != nil {
+					panics[i] = r
+					cancel()
+				}
+			}()
+			sub := &SearchTree{}
+			if d.decompose(sctx, sub, Hc, n.bag) {
+				roots[i] = sub.root
+			} else if sctx.Err() == nil {
+				failed[i] = true // not stopped by a sibling, so Hc has no decomposition
+				cancel()
+			}
+		}
+		select {
+		case d.sem <- struct{}{}:
+			wg.Add(1)
+			go func() {
+				defer func() {
+					<-d.sem
+					wg.Done()
+				}()
+				solve()
+			}()
+		default:
+			solve() // no free worker, and waiting for one could deadlock
 		}
 	}
-	if found {
-		d.sTree.MoveToParent()
-	} else {
-		d.sTree.RemoveChildren()
+	wg.Wait()
+
+	for i, r := range panics {
+		if r != nil {
+			panic(r)
+		}
+		if failed[i] {
+			d.cache.AddNegative(n.sep, n.myComps[i])
+		}
 	}
-	return found
+	for _, root := range roots {
+		if root == nil {
+			return false
+		}
+	}
+	for _, root := range roots {
+		root.parent = n
+		n.children = append(n.children, root)
+	}
+	return true
 }
 
-func (d *DetKStreamer) advance() bool {
+// advance moves the tree to the next decomposition, like an odometer: it
+// moves the last node in preorder with another separator to it, removing the
+// nodes after it, and decomposes again the components left without a node.
+func (d *DetKStreamer) advance(ctx context.Context) (bool, error) {
 	found := false
 	dfs := d.sTree.dfs()
 	for len(dfs) > 0 {
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
 		d.sTree.curr, dfs = dfs[len(dfs)-1], dfs[:len(dfs)-1]
 		n := d.sTree.curr
-		found = false
-		for n.sepGen.HasNext() {
-			n.sep = n.sepGen.Next()
-			n.bag = lib.Inter(n.sep.Vertices(), n.extVerts)
-			n.myComps, _, _ = n.hg.GetComponents(n.sep)
-			if len(n.myComps) == 0 {
-				found = true
-				break
-			}
-			if d.cache.CheckNegative(n.sep, n.myComps) {
-				break
-			}
-			allSubDecomp := true
-			for _, Hc := range n.myComps {
-				allSubDecomp = d.decompose(Hc, n.bag)
-				if !allSubDecomp {
-					d.cache.AddNegative(n.sep, Hc)
-					break
-				}
-			}
-			if allSubDecomp {
-				found = true
-				break
-			}
-		}
+		found = d.nextSep(ctx, &d.sTree, n)
 		if found {
 			d.sTree.MoveToParent()
 			par := d.sTree.curr
 			for par != nil {
 				for i := len(par.children); i < len(par.myComps); i++ {
 					Hc := par.myComps[i]
-					if !d.decompose(Hc, par.bag) {
-						panic(fmt.Errorf("one decomposition should exist"))
+					if !d.decompose(ctx, &d.sTree, Hc, par.bag) {
+						if err := ctx.Err(); err != nil {
+							return false, err
+						}
+						return false, fmt.Errorf("one decomposition should exist")
 					}
 				}
 				d.sTree.MoveToParent()
@@ -130,40 +237,58 @@ func (d *DetKStreamer) advance() bool {
 			}
 			break
 		}
-		d.sTree.RemoveChildren()
+		d.sTree.RemoveChild() // the nodes after n in preorder are already removed
 	}
-	return found
+	return found, ctx.Err()
 }
 
+// BestDetKStreamer scores every decomposition of DetK, sending each one that
+// is cheaper than the ones before it. If the search is stopped, the last one
+// sent is the best found so far.
 type BestDetKStreamer struct {
 	DetK *DetKStreamer
 	Ev   *Evaluator
+
+	scored int64
+}
+
+// Scorer is a Streamer that evaluates candidate decompositions to pick the ones it sends
+type Scorer interface {
+	Streamer
+	// Scored returns how many candidates have been evaluated so far
+	Scored() int
 }
 
 func (b *BestDetKStreamer) Name() string {
 	return "BestDetK"
 }
 
-func (b *BestDetKStreamer) Stream(stop <-chan bool) <-chan Decomp {
-	out := make(chan Decomp)
-	go func() {
-		defer close(out)
+func (b *BestDetKStreamer) Scored() int {
+	return int(atomic.LoadInt64(&b.scored))
+}
 
-		var currDecomp Decomp
-		currCost := int(^uint(0) >> 1) // max int
-		for dec := range b.DetK.Stream(stop) {
+func (b *BestDetKStreamer) Stream(ctx context.Context) (<-chan Decomp, <-chan error) {
+	atomic.StoreInt64(&b.scored, 0)
+	return stream(ctx, func(emit func(Decomp) error) error {
+		bestCost := int(^uint(0) >> 1) // max int
+		decomps, errc := b.DetK.Stream(ctx)
+		for dec := range decomps {
 			cost := b.Ev.Eval(dec)
-			if cost < currCost {
-				currDecomp = dec
-				currCost = cost
+			atomic.AddInt64(&b.scored, 1)
+			if cost < bestCost {
+				bestCost = cost
+				if err := emit(dec); err != nil {
+					return err
+				}
 			}
 		}
-		// todo what about the stop channel?
-		out <- currDecomp
-	}()
-	return out
+		return <-errc
+	})
 }
 
+// BnbDetKStreamer searches the whole space of DetKStreamer with branch and
+// bound, sending every decomposition cheaper than the ones before it. When
+// the search is complete, the last one is optimal under Ev.
 type BnbDetKStreamer struct {
 	K     int
 	Graph lib.Graph
@@ -171,138 +296,105 @@ type BnbDetKStreamer struct {
 
 	cache lib.Cache
 
-	Ev            *Evaluator
-	currOptDecomp Decomp
-	currOptCost   int
+	Ev       *Evaluator
+	bestCost int
 }
 
+// the outcomes of a search, from the worst to the best
+const (
+	infeasible = iota // no decomposition exists
+	pruned            // none found, but some were cut by the bound
+	found             // at least one was completed
+)
+
 func (d *BnbDetKStreamer) Name() string {
 	return "BnbDetK"
 }
 
-func (d *BnbDetKStreamer) Stream(stop <-chan bool) <-chan Decomp {
-	out := make(chan Decomp)
-	go func() {
-		defer close(out)
-
-		d.currOptDecomp = Decomp{Graph: d.Graph, Root: lib.Node{Bag: d.Graph.Vertices(), Cover: d.Graph.Edges}}
-		d.currOptCost = d.Ev.Eval(d.currOptDecomp)
-		select {
-		case out <- d.currOptDecomp:
-		case <-stop:
-			return
-		}
-
+func (d *BnbDetKStreamer) Stream(ctx context.Context) (<-chan Decomp, <-chan error) {
+	return stream(ctx, func(emit func(Decomp) error) error {
 		d.cache.Init()
-		if found, cost := d.decompose(d.Graph, []int{}); found {
-			d.currOptDecomp = MakeDecomp(d.sTree)
-			d.currOptCost = cost
-			select {
-			case out <- d.currOptDecomp:
-			case <-stop:
-				return
-			}
-		}
-		/*for d.advance() {
-			select {
-			case out <- d.buildDecomp():
-			case <-stop:
-				return
+		d.sTree = SearchTree{}
+		d.bestCost = int(^uint(0) >> 1) // max int
+		_, err := d.decompose(ctx, d.Graph, []int{}, 0, func(int) (int, error) {
+			if cost := d.Ev.EvalTree(&d.sTree); cost < d.bestCost {
+				d.bestCost = cost
+				return found, emit(MakeDecomp(d.sTree))
 			}
-		}*/
-	}()
-	return out
+			return found, nil
+		})
+		return err
+	})
 }
 
-func (d *BnbDetKStreamer) decompose(H Graph, oldSep []int) (bool, int) {
+// decompose tries every separator of H, calling next on each complete
+// decomposition of H with the cost so far. The cost of the nodes is a lower
+// bound of the cost of a decomposition, so separators that would reach the
+// best cost are cut. It returns the outcome of the search of H alone.
+func (d *BnbDetKStreamer) decompose(ctx context.Context, H Graph, oldSep []int, cost int, next func(cost int) (int, error)) (int, error) {
 	sepGen := NewDetKSepGen(H, d.K, d.Graph.Edges, oldSep)
 	n := d.sTree.MakeChild(H, sepGen)
 	n.extVerts = append(H.Vertices(), oldSep...)
-	found := false
-	myCurrCost := 0
+	res := infeasible
 	for n.sepGen.HasNext() {
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
 		n.sep = n.sepGen.Next()
 		n.bag = lib.Inter(n.sep.Vertices(), n.extVerts)
-		myCurrCost = d.Ev.EvalNode(n)
-		if myCurrCost > d.currOptCost {
-			myCurrCost = 0
+		nodeCost := d.Ev.EvalNode(n)
+		if cost+nodeCost >= d.bestCost {
+			res = max(res, pruned)
 			continue
 		}
-		n.myComps, _, _ = H.GetComponents(n.sep)
-		if len(n.myComps) == 0 {
-			found = true
-			break
-		}
-		allSubDecomp := true
-		for _, Hc := range n.myComps {
-			subDecomp, subCost := d.decompose(Hc, n.bag)
-			edgeCost := d.Ev.EvalEdge(n, d.sTree.curr)
-			myCurrCost += subCost + edgeCost
-			if !subDecomp || myCurrCost > d.currOptCost {
-				allSubDecomp = false
-				myCurrCost = 0
-				break
-			}
+		n.myComps = components(H, n.sep)
+		if d.cache.CheckNegative(n.sep, n.myComps) {
+			continue
 		}
-		if allSubDecomp {
-			found = true
-			break
+		status, err := d.decomposeComps(ctx, n, 0, cost+nodeCost, next)
+		if err != nil {
+			return res, err
 		}
+		res = max(res, status)
 	}
-	if found {
-		d.sTree.MoveToParent()
-	} else {
-		d.sTree.RemoveChildren()
+	d.sTree.RemoveChild()
+	return res, nil
+}
+
+// decomposeComps decomposes the components of n from the i-th on, and then
+// calls next on the parent of n
+func (d *BnbDetKStreamer) decomposeComps(ctx context.Context, n *SearchNode, i int, cost int, next func(cost int) (int, error)) (int, error) {
+	if i == len(n.myComps) {
+		d.sTree.curr = n.parent
+		_, err := next(cost)
+		d.sTree.curr = n
+		return found, err
 	}
-	if d.Ev.EvalTree(&d.sTree) != myCurrCost {
-		panic(fmt.Errorf("actual cost != current cost, %v != %v", d.Ev.EvalTree(&d.sTree), myCurrCost))
+	Hc := n.myComps[i]
+	if d.cache.CheckNegative(n.sep, []Graph{Hc}) {
+		return infeasible, nil
 	}
-	return found, myCurrCost
+	rest := infeasible
+	status, err := d.decompose(ctx, Hc, n.bag, cost, func(cost int) (int, error) {
+		status, err := d.decomposeComps(ctx, n, i+1, cost, next)
+		rest = max(rest, status)
+		return status, err
+	})
+	if err != nil {
+		return infeasible, err
+	}
+	if status == infeasible {
+		d.cache.AddNegative(n.sep, Hc)
+	}
+	if status != found {
+		return status, nil
+	}
+	return rest, nil // the later components are independent of Hc
 }
 
-/*func (d *BnbDetKStreamer) advance() bool {
-	found := false
-	dfs := d.sTree.dfs()
-	for len(dfs) > 0 {
-		d.sTree.curr, dfs = dfs[len(dfs)-1], dfs[:len(dfs)-1]
-		n := d.sTree.curr
-		found = false
-		for n.sepGen.HasNext() {
-			n.sep = n.sepGen.Next()
-			n.bag = lib.Inter(n.sep.Vertices(), n.extVerts)
-			n.myComps, _, _ = n.H.GetComponents(n.sep)
-			if len(n.myComps) == 0 {
-				found = true
-				break
-			}
-			allSubDecomp := true
-			for _, Hc := range n.myComps {
-				allSubDecomp = d.decompose(Hc, n.bag)
-				if !allSubDecomp {
-					break
-				}
-			}
-			if allSubDecomp {
-				found = true
-				break
-			}
-		}
-		if found {
-			d.sTree.moveUp()
-			par := d.sTree.curr
-			for par != nil {
-				for i := len(par.children); i < len(par.myComps); i++ {
-					Hc := par.myComps[i]
-					if !d.decompose(Hc, par.bag) {
-						panic(fmt.Errorf("one decomposition should exist"))
-					}
-				}
-				d.sTree.moveUp()
-				par = d.sTree.curr
-			}
-			break
-		}
-		d.sTree.removeChild()
+func max(a int, b int) int {
+	if a > b {
+		return a
 	}
-	return found
-}*/
+	return b
+}
@@ -0,0 +1,238 @@
+package decomp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/cem-okulmus/BalancedGo/lib"
+)
+
+func TestDetKStreamComplete(t *testing.T) {
+	hg, _ := lib.GetGraph("a(X,Y), b(Y,Z), c(Z,W).")
+	d := &DetKStreamer{K: 1, Graph: hg}
+	decomps, errc := d.Stream(context.Background())
+	n := 0
+	for dec := range decomps {
+		if !dec.Correct(hg) {
+			t.Errorf("decomposition %v is not correct", n)
+		}
+		n++
+	}
+	if err := <-errc; err != nil {
+		t.Errorf("complete search ended with %v", err)
+	}
+	if n != 3 {
+		t.Errorf("found %v decompositions, want 3", n)
+	}
+}
+
+func TestDetKStreamCancel(t *testing.T) {
+	hg, _ := lib.GetGraph("r(X,Y), s(Y,Z), t(Z,X), u(Z,W).")
+	d := &DetKStreamer{K: 2, Graph: hg}
+	ctx, cancel := context.WithCancel(context.Background())
+	decomps, errc := d.Stream(ctx)
+	if _, ok := <-decomps; !ok {
+		t.Fatal("no decomposition found")
+	}
+	cancel()
+	for range decomps {
+	}
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled search ended with %v", err)
+	}
+}
+
+// bnbCosts streams the decompositions of bnb, checking that they are correct
+// and strictly cheaper one after the other, and returns the last cost
+func bnbCosts(t *testing.T, hg lib.Graph, k int, ev *Evaluator) int {
+	decomps, errc := (&BnbDetKStreamer{K: k, Graph: hg, Ev: ev}).Stream(context.Background())
+	last := -1
+	for dec := range decomps {
+		if !dec.Correct(hg) {
+			t.Errorf("k=%v: decomposition %v is not correct", k, dec)
+		}
+		cost := ev.Eval(dec)
+		if last >= 0 && cost >= last {
+			t.Errorf("k=%v: cost %v after %v, want strictly less", k, cost, last)
+		}
+		last = cost
+	}
+	if err := <-errc; err != nil {
+		t.Errorf("k=%v: complete search ended with %v", k, err)
+	}
+	return last
+}
+
+func TestBnbDetKStreamOptimal(t *testing.T) {
+	hg, parsed := lib.GetGraph("a(X,Y), b(Y,Z), c(Z,W).")
+	ev := testEvaluator(t, hg, parsed.Encoding, pathStats)
+
+	for k := 1; k <= 2; k++ {
+		best := -1
+		decomps, errc := (&DetKStreamer{K: k, Graph: hg}).Stream(context.Background())
+		for dec := range decomps {
+			cost := ev.Eval(dec)
+			if again := ev.Eval(dec); again != cost {
+				t.Errorf("evaluating twice gives %v and %v", cost, again)
+			}
+			if best < 0 || cost < best {
+				best = cost
+			}
+		}
+		if err := <-errc; err != nil {
+			t.Fatal(err)
+		}
+		if got := bnbCosts(t, hg, k, ev); got != best {
+			t.Errorf("k=%v: last cost %v, want the optimum %v", k, got, best)
+		}
+	}
+}
+
+func TestBestDetKStreamAnytime(t *testing.T) {
+	hg, parsed := lib.GetGraph("a(X,Y), b(Y,Z), c(Z,W).")
+	ev := testEvaluator(t, hg, parsed.Encoding, pathStats)
+
+	b := &BestDetKStreamer{DetK: &DetKStreamer{K: 1, Graph: hg}, Ev: ev}
+	decomps, errc := b.Stream(context.Background())
+	last := -1
+	for dec := range decomps {
+		cost := ev.Eval(dec)
+		if last >= 0 && cost >= last {
+			t.Errorf("cost %v after %v, want strictly less", cost, last)
+		}
+		last = cost
+	}
+	if err := <-errc; err != nil {
+		t.Errorf("complete search ended with %v", err)
+	}
+	if want := bnbCosts(t, hg, 1, ev); last != want {
+		t.Errorf("last cost %v, want the optimum %v", last, want)
+	}
+	if b.Scored() != 3 {
+		t.Errorf("scored %v candidates, want 3", b.Scored())
+	}
+
+	b = &BestDetKStreamer{DetK: &DetKStreamer{K: 2, Graph: hg}, Ev: ev}
+	ctx, cancel := context.WithCancel(context.Background())
+	decomps, errc = b.Stream(ctx)
+	if _, ok := <-decomps; !ok {
+		t.Fatal("no decomposition before the cancellation")
+	}
+	cancel()
+	for range decomps {
+	}
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled search ended with %v", err)
+	}
+	if b.Scored() < 1 {
+		t.Errorf("scored %v candidates, want at least 1", b.Scored())
+	}
+}
+
+// detkStrings streams at most limit decompositions of a DetKStreamer
+func detkStrings(t *testing.T, d *DetKStreamer, limit int) []string {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	decomps, errc := d.Stream(ctx)
+	var res []string
+	for dec := range decomps {
+		if !dec.Correct(d.Graph) {
+			t.Errorf("decomposition %v is not correct", dec)
+		}
+		res = append(res, dec.String())
+		if len(res) == limit {
+			cancel()
+			break
+		}
+	}
+	for range decomps {
+	}
+	if err := <-errc; err != nil && !errors.Is(err, context.Canceled) {
+		t.Errorf("search ended with %v", err)
+	}
+	return res
+}
+
+func TestDetKStreamParallel(t *testing.T) {
+	hg, _ := lib.GetGraph("c(X,Y,Z,W), a(X,A), b(Y,B), d(Z,D), e(W,E,F), f(F,G).")
+	for k := 1; k <= 2; k++ {
+		want := detkStrings(t, &DetKStreamer{K: k, Graph: hg}, 200)
+		if len(want) == 0 {
+			t.Fatalf("k=%v: no decomposition found", k)
+		}
+		for _, workers := range []int{2, 4} {
+			got := detkStrings(t, &DetKStreamer{K: k, Graph: hg, Workers: workers}, 200)
+			if len(got) != len(want) {
+				t.Fatalf("k=%v, %v workers: %v decompositions, want %v", k, workers, len(got), len(want))
+			}
+			for i := range got {
+				if got[i] != want[i] {
+					t.Fatalf("k=%v, %v workers: decomposition %v is\n%v\nwant\n%v", k, workers, i, got[i], want[i])
+				}
+			}
+		}
+	}
+}
+
+// A separator with a component known to fail must not stop the search of the
+// other separators of its node, which could still decompose it
+func TestDetKStreamCachedFailure(t *testing.T) {
+	hg, parsed := lib.GetGraph("e0(C,E,G), e1(F,B), e2(A,C), e3(A,F,G), e4(A,C,B), e5(E,B).")
+	var stats strings.Builder
+	for _, e := range hg.Edges.Slice() {
+		name := Names(parsed.Encoding)[e.Name]
+		fmt.Fprintf(&stats, "size,%v,10\n", name)
+		for _, v := range e.Vertices {
+			fmt.Fprintf(&stats, "ndv,%v,%v,3\n", name, Names(parsed.Encoding)[v])
+		}
+	}
+	ev := testEvaluator(t, hg, parsed.Encoding, stats.String())
+
+	// the ranked search only prunes the components that have no decomposition,
+	// so it finds all the decompositions
+	want := make(map[string]bool)
+	decomps, errc := (&RankedDetKStreamer{K: 2, Graph: hg, Ev: ev}).Stream(context.Background())
+	for dec := range decomps {
+		want[dec.String()] = true
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]bool)
+	decomps, errc = (&DetKStreamer{K: 2, Graph: hg}).Stream(context.Background())
+	for dec := range decomps {
+		got[dec.String()] = true
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) {
+		t.Errorf("found %v distinct decompositions, want %v", len(got), len(want))
+	}
+}
+
+// Advancing a node must not decompose its siblings from scratch again, which
+// sends the same decompositions forever
+func TestDetKStreamNoRepeats(t *testing.T) {
+	hg, _ := lib.GetGraph("a(X,Y), b(Y,Z), c(Z,W), d(W,V), e(V,U).")
+	for k := 1; k <= 3; k++ {
+		seen := make(map[string]bool)
+		decomps, errc := (&DetKStreamer{K: k, Graph: hg}).Stream(context.Background())
+		for dec := range decomps {
+			if seen[dec.String()] {
+				t.Fatalf("k=%v: decomposition %v sent twice", k, dec)
+			}
+			seen[dec.String()] = true
+		}
+		if err := <-errc; err != nil {
+			t.Fatal(err)
+		}
+		if len(seen) == 0 {
+			t.Errorf("k=%v: no decomposition found", k)
+		}
+	}
+}
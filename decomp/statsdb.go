@@ -8,13 +8,22 @@ import (
 	"io"
 	"os"
 	"strconv"
+	"sync"
 
 	"github.com/cem-okulmus/BalancedGo/lib"
 	"github.com/dmlongo/hd-gen/db"
 )
 
-// SizeEstimates associates statistics to combinations of edges
-type StatisticsDB map[uint64]*db.Statistics
+// StatisticsDB associates statistics to combinations of edges. It is safe for
+// concurrent use, since a search evaluates decompositions on its own goroutine.
+type StatisticsDB struct {
+	mu    *sync.RWMutex
+	stats map[uint64]*db.Statistics
+}
+
+func NewStatisticsDB() StatisticsDB {
+	return StatisticsDB{mu: &sync.RWMutex{}, stats: make(map[uint64]*db.Statistics)}
+}
 
 func LoadStatistics(path string, graph Graph, encoding map[string]int) StatisticsDB {
 	// 1. read the csv file
@@ -24,7 +33,7 @@ func LoadStatistics(path string, graph Graph, encoding map[string]int) Statistic
 	}
 
 	// 2. init map
-	res := make(StatisticsDB)
+	res := NewStatisticsDB()
 	var edgeCombs []lib.Edges
 
 	r := csv.NewReader(csvfile)
@@ -94,7 +103,7 @@ func LoadStatistics(path string, graph Graph, encoding map[string]int) Statistic
 		}
 		newSize, newCombStats := db.EstimateJoinSize(edgeStats)
 		if oldSize != newSize {
-			fmt.Println("new size estimate for", edges, ":", oldSize, "->", newSize)
+			fmt.Fprintln(os.Stderr, "new size estimate for", edges, ":", oldSize, "->", newSize)
 		}
 		res.Put(edges, newCombStats)
 	}
@@ -141,16 +150,18 @@ func findEdge(edges lib.Edges, name int) (lib.Edge, bool) {
 // Put the statistics of an edge combination into the map
 func (sdb StatisticsDB) Put(edges lib.Edges, stats *db.Statistics) {
 	h := hashNames(edges)
-	sdb[h] = stats
+	sdb.mu.Lock()
+	defer sdb.mu.Unlock()
+	sdb.stats[h] = stats
 }
 
 // Statistics of an edge combination
 func (sdb StatisticsDB) Stats(edges lib.Edges) (*db.Statistics, bool) {
 	h := hashNames(edges)
-	if c, ok := sdb[h]; ok {
-		return c, true
-	}
-	return nil, false
+	sdb.mu.RLock()
+	defer sdb.mu.RUnlock()
+	c, ok := sdb.stats[h]
+	return c, ok
 }
 
 func hashNames(edges lib.Edges) uint64 {
@@ -172,7 +183,7 @@ func hashNames(edges lib.Edges) uint64 {
 }
 
 func StatsFromDB(data db.Database, graph Graph, encoding map[string]int) StatisticsDB {
-	res := make(StatisticsDB)
+	res := NewStatisticsDB()
 	for tName, tab := range data {
 		eName := encoding[tName]
 		edge := selectEdges(graph, []int{eName})
@@ -0,0 +1,29 @@
+package decomp
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// pathStats are the statistics of the path a(X,Y), b(Y,Z), c(Z,W)
+const pathStats = `size,a,10
+size,b,20
+size,c,5
+ndv,a,X,5
+ndv,a,Y,4
+ndv,b,Y,4
+ndv,b,Z,10
+ndv,c,Z,5
+ndv,c,W,5
+`
+
+// testEvaluator estimates costs with stats, written in the CSV format of LoadStatistics
+func testEvaluator(t *testing.T, hg Graph, encoding map[string]int, stats string) *Evaluator {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "stats.csv")
+	if err := ioutil.WriteFile(path, []byte(stats), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return &Evaluator{StatsDB: LoadStatistics(path, hg, encoding)}
+}
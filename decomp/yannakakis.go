@@ -1,6 +1,10 @@
 package decomp
 
 import (
+	"fmt"
+	"time"
+
+	"github.com/cem-okulmus/BalancedGo/lib"
 	"github.com/dmlongo/hd-gen/db"
 )
 
@@ -11,6 +15,11 @@ type Yannakakis interface {
 	// AllSolutions of the problem represent by the given tree
 	AllAnswers() *db.Table
 
+	// Phases reports the time spent in each phase by the last answer
+	Phases() YPhases
+	// Joins reports the operators chosen to join the tables of the nodes
+	Joins() []JoinChoice
+
 	// join tables in every node
 	computeNodes(curr *yNode) bool
 	// reduce a tree with upwards semijoins
@@ -21,66 +30,188 @@ type Yannakakis interface {
 	joinUpwards(root *yNode) *db.Table
 }
 
+// MakeYannakakis evaluates tree over the tables of d mapped by e2t. Tables are
+// joined on the names of their attributes, so edges over the same relation
+// need views of it with distinct attributes, as given by Table.Rename.
+//
+// Each node joins its cover and projects it on its bag. An edge only partly
+// in the bag loses its constraint by the projection, so every edge is also
+// checked in full at the first node whose bag contains it.
+// Nodes are sets, as GenericJoin makes them: duplicate tuples of the tables
+// never reach the answers.
 func MakeYannakakis(tree *SearchTree, e2t map[int]string, d db.Database) Yannakakis {
-	var yRoot *yNode
-	var n *SearchNode
-	var p *yNode
-	var open []*SearchNode
-	var parents []*yNode
-	if tree.root != nil {
-		open = append(open, tree.root)
-		parents = append(parents, nil)
+	if tree.root == nil {
+		return &yTree{}
 	}
+	edges := tree.root.hg.Edges.Slice()
+	attrs := vertexAttrs(edges, e2t, d)
+	checked := make(map[int]bool)
+
+	var yRoot *yNode
+	var sNodes []*SearchNode
+	var yNodes []*yNode
+	open := []*SearchNode{tree.root}
+	parents := []*yNode{nil}
 	for len(open) > 0 {
+		var n *SearchNode
+		var p *yNode
 		n, open = open[len(open)-1], open[:len(open)-1]
 		p, parents = parents[len(parents)-1], parents[:len(parents)-1]
 
 		y := &yNode{}
 		for _, e := range n.sep.Slice() {
-			t := d[e2t[e.Name]]
-			y.tables = append(y.tables, t)
+			y.tables = append(y.tables, d[e2t[e.Name]])
+			if lib.Subset(e.Vertices, n.bag) {
+				checked[e.Name] = true
+			}
 		}
-		// todo proj = bag missing
+		y.proj = bagAttrs(n.bag, attrs)
 		if p != nil {
 			p.children = append(p.children, y)
 		}
 		if yRoot == nil {
 			yRoot = y
 		}
+		sNodes = append(sNodes, n)
+		yNodes = append(yNodes, y)
 
 		for i := range n.children {
 			open = append(open, n.children[len(n.children)-i-1])
 			parents = append(parents, y)
 		}
 	}
+
+	for _, e := range edges {
+		if checked[e.Name] {
+			continue
+		}
+		found := false
+		for i, n := range sNodes {
+			if lib.Subset(e.Vertices, n.bag) {
+				yNodes[i].checks = append(yNodes[i].checks, d[e2t[e.Name]])
+				found = true
+				break
+			}
+		}
+		if !found {
+			panic(fmt.Errorf("no bag contains edge %v", e))
+		}
+	}
 	return &yTree{root: yRoot}
 }
 
+// vertexAttrs names each vertex after the column of its position in the tables
+// of the edges, which must agree on the name of every vertex
+func vertexAttrs(edges []lib.Edge, e2t map[int]string, d db.Database) map[int]string {
+	res := make(map[int]string)
+	vertices := make(map[string]int)
+	for _, e := range edges {
+		t, ok := d[e2t[e.Name]]
+		if !ok {
+			panic(fmt.Errorf("no table for edge %v", e))
+		}
+		if len(t.Attributes()) != len(e.Vertices) {
+			panic(fmt.Errorf("table %v has %v columns, edge %v has %v vertices", e2t[e.Name], len(t.Attributes()), e, len(e.Vertices)))
+		}
+		for i, v := range e.Vertices {
+			a := t.Attributes()[i]
+			if old, ok := res[v]; ok && old != a {
+				panic(fmt.Errorf("vertex %v is both %v and %v in table %v", v, old, a, e2t[e.Name]))
+			}
+			if old, ok := vertices[a]; ok && old != v {
+				panic(fmt.Errorf("attribute %v of table %v names two vertices", a, e2t[e.Name]))
+			}
+			res[v] = a
+			vertices[a] = v
+		}
+	}
+	return res
+}
+
+// bagAttrs returns the attributes of bag
+func bagAttrs(bag []int, attrs map[int]string) []string {
+	res := make([]string, 0, len(bag))
+	for _, v := range bag {
+		a, ok := attrs[v]
+		if !ok {
+			panic(fmt.Errorf("vertex %v of a bag is in no edge", v))
+		}
+		res = append(res, a)
+	}
+	return res
+}
+
 type yNode struct {
-	tables []*db.Table
+	tables []*db.Table // the cover
+	checks []*db.Table // edges inside the bag, but not in the cover
 
 	join *db.Table
-	//proj []string
+	proj []string // attributes of the bag
 
 	children []*yNode
 }
 
 type yTree struct {
 	root *yNode
+
+	phases YPhases
+	joins  []JoinChoice
+}
+
+// JoinChoice is the operator chosen for a join in a node, with the sizes of its inputs
+type JoinChoice struct {
+	Algorithm db.JoinAlgorithm
+	Inputs    []int
+}
+
+// YPhases are the durations of the phases of Yannakakis
+type YPhases struct {
+	NodeJoins time.Duration
+	BottomUp  time.Duration
+	TopDown   time.Duration
+	JoinUp    time.Duration
 }
 
 func (y *yTree) BoolAnswer() bool {
-	return y.computeNodes(y.root) && y.reduce(y.root)
+	y.phases, y.joins = YPhases{}, nil
+	return y.timedComputeNodes() && y.timedReduce()
 }
 
 func (y *yTree) AllAnswers() *db.Table {
-	if y.computeNodes(y.root) && y.reduce(y.root) {
+	y.phases, y.joins = YPhases{}, nil
+	if y.timedComputeNodes() && y.timedReduce() {
+		start := time.Now()
 		y.fullyReduce(y.root)
-		return y.joinUpwards(y.root)
+		y.phases.TopDown = time.Since(start)
+
+		start = time.Now()
+		res := y.joinUpwards(y.root)
+		y.phases.JoinUp = time.Since(start)
+		return res
 	}
 	return nil
 }
 
+func (y *yTree) Phases() YPhases {
+	return y.phases
+}
+
+func (y *yTree) Joins() []JoinChoice {
+	return y.joins
+}
+
+func (y *yTree) timedComputeNodes() bool {
+	start := time.Now()
+	defer func() { y.phases.NodeJoins = time.Since(start) }()
+	return y.computeNodes(y.root)
+}
+
+func (y *yTree) timedReduce() bool {
+	start := time.Now()
+	defer func() { y.phases.BottomUp = time.Since(start) }()
+	return y.reduce(y.root)
+}
+
 func (y *yTree) computeNodes(curr *yNode) bool {
 	if !y.joinNode(curr) {
 		return false
@@ -98,15 +229,38 @@ func (y *yTree) joinNode(curr *yNode) bool {
 		if len(curr.tables) == 1 {
 			curr.join = curr.tables[0]
 		} else {
-			curr.join = db.Join(*curr.tables[0], *curr.tables[1])
-			for i := 2; i < len(curr.tables) && !curr.join.Empty(); i++ {
-				curr.join = db.Join(*curr.join, *curr.tables[i])
-			}
+			curr.join = y.join(curr.tables)
+		}
+		// Project removes duplicates, so every node is a set whichever operator
+		// joined it, and makes a new table that the reductions can change
+		attrs := curr.join.Attributes()
+		if curr.proj != nil && len(curr.proj) < len(attrs) {
+			attrs = curr.proj
+		}
+		curr.join = db.Project(*curr.join, attrs)
+		for _, t := range curr.checks {
+			db.Semijoin(curr.join, *t)
 		}
 	}
 	return !curr.join.Empty()
 }
 
+// join the tables of a node, all at once if the cover is larger than two edges,
+// otherwise with the binary operator that ChooseJoin deems cheapest
+func (y *yTree) join(tables []*db.Table) *db.Table {
+	sizes := make([]int, len(tables))
+	for i, t := range tables {
+		sizes[i] = t.Size()
+	}
+	if len(tables) > 2 {
+		y.joins = append(y.joins, JoinChoice{Algorithm: db.Generic, Inputs: sizes})
+		return db.GenericJoin(tables...)
+	}
+	alg := db.ChooseJoin(tables[0], tables[1])
+	y.joins = append(y.joins, JoinChoice{Algorithm: alg, Inputs: sizes})
+	return db.JoinWith(alg, *tables[0], *tables[1])
+}
+
 // bottom-up phase
 func (y *yTree) reduce(curr *yNode) bool {
 	for _, child := range curr.children {
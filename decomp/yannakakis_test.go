@@ -1,8 +1,14 @@
 package decomp
 
 import (
+	"context"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/cem-okulmus/BalancedGo/lib"
 	"github.com/dmlongo/hd-gen/db"
 )
 
@@ -172,7 +178,7 @@ func test1Data() (*yTree, *yTree, *yTree, *yTree, *db.Table) {
 		{"8", "3", "9", "8", "3", "8"},
 	})
 
-	return &yTree{dInput}, &yTree{dJNodes}, &yTree{dPartial}, &yTree{dOutput}, answers
+	return &yTree{root: dInput}, &yTree{root: dJNodes}, &yTree{root: dPartial}, &yTree{root: dOutput}, answers
 }
 
 func test2Data() (*yTree, *yTree, *yTree, *yTree, *db.Table) {
@@ -313,7 +319,7 @@ func test2Data() (*yTree, *yTree, *yTree, *yTree, *db.Table) {
 		{"1", "4", "8", "3", "9", "8", "3", "8"},
 	})
 
-	return &yTree{dInput}, &yTree{dJNodes}, &yTree{dPartial}, &yTree{dOutput}, answers
+	return &yTree{root: dInput}, &yTree{root: dJNodes}, &yTree{root: dPartial}, &yTree{root: dOutput}, answers
 }
 
 func test3Data() *yTree {
@@ -346,5 +352,320 @@ func test3Data() *yTree {
 	rInput.children = append(rInput.children, sInput)
 	rInput.children = append(rInput.children, tInput)
 
-	return &yTree{dInput}
+	return &yTree{root: dInput}
+}
+
+func TestYannakPhases(t *testing.T) {
+	y, _, _, _, _ := test1Data()
+	y.BoolAnswer()
+	if p := y.Phases(); p.TopDown != 0 || p.JoinUp != 0 {
+		t.Errorf("BoolAnswer timed the top-down phases: %+v", p)
+	}
+	y, _, _, _, _ = test1Data()
+	y.AllAnswers()
+	if p := y.Phases(); p.NodeJoins <= 0 || p.JoinUp <= 0 {
+		t.Errorf("AllAnswers did not time its phases: %+v", p)
+	}
+}
+
+func TestYannakSharedDB(t *testing.T) {
+	hg, parsed := lib.GetGraph("a(X,Y), b(Y,Z).")
+	gml := `graph [
+	  node [ id 1 label "{b} {Y, Z}" ]
+	  node [ id 2 label "{a} {X, Y}" ]
+	  node [ id 3 label "{a} {X, Y}" ]
+	  edge [ source 1 target 2 ]
+	  edge [ source 2 target 3 ]
+	]`
+	dec, err := ParseGML(gml, hg, parsed.Encoding)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := db.NewTable([]string{"X", "Y"}, true)
+	a.AddTuples([]db.Tuple{{"1", "2"}, {"2", "3"}, {"3", "4"}})
+	b := db.NewTable([]string{"Y", "Z"}, true)
+	b.AddTuples([]db.Tuple{{"2", "5"}, {"4", "6"}, {"7", "8"}})
+	data := db.Database{"a": a, "b": b}
+	e2t := map[int]string{parsed.Encoding["a"]: "a", parsed.Encoding["b"]: "b"}
+
+	for i := 0; i < 2; i++ {
+		y := MakeYannakakis(MakeSearchTree(dec), e2t, data)
+		if ans := y.AllAnswers(); ans == nil || ans.Size() != 2 {
+			t.Errorf("run %v: answers %v, want 2", i, ans)
+		}
+		if a.Size() != 3 || b.Size() != 3 {
+			t.Errorf("run %v: the database was reduced to %v and %v tuples", i, a.Size(), b.Size())
+		}
+	}
+}
+
+func TestYannakBagProjection(t *testing.T) {
+	hg, parsed := lib.GetGraph("a(X,Y), b(Y,Z), c(Z,W).")
+	a := db.NewTable([]string{"X", "Y"}, true)
+	a.AddTuples([]db.Tuple{{"1", "2"}, {"2", "2"}, {"3", "4"}})
+	b := db.NewTable([]string{"Y", "Z"}, true)
+	b.AddTuples([]db.Tuple{{"2", "5"}, {"4", "7"}})
+	c := db.NewTable([]string{"Z", "W"}, true)
+	c.AddTuples([]db.Tuple{{"5", "8"}, {"5", "9"}, {"6", "8"}, {"7", "1"}})
+	data := db.Database{"a": a, "b": b, "c": c}
+	e2t := map[int]string{parsed.Encoding["a"]: "a", parsed.Encoding["b"]: "b", parsed.Encoding["c"]: "c"}
+	want := db.Join(*db.Join(*a, *b), *c)
+
+	tests := []string{
+		`graph [
+		  node [ id 1 label "{a, c} {X, Y, Z}" ]
+		  node [ id 2 label "{b} {Y, Z}" ]
+		  node [ id 3 label "{c} {Z, W}" ]
+		  edge [ source 1 target 2 ]
+		  edge [ source 1 target 3 ]
+		]`,
+		`graph [
+		  node [ id 1 label "{a, c} {X, Y, Z}" ]
+		  node [ id 2 label "{c} {Z, W}" ]
+		  edge [ source 1 target 2 ]
+		]`, // b is in no cover
+	}
+	for i, gml := range tests {
+		dec, err := ParseGML(gml, hg, parsed.Encoding)
+		if err != nil {
+			t.Fatal(err)
+		}
+		y := MakeYannakakis(MakeSearchTree(dec), e2t, data).(*yTree)
+		if !y.computeNodes(y.root) {
+			t.Fatalf("decomposition %v: unsat", i)
+		}
+		if got := y.root.join.Attributes(); len(got) != 3 {
+			t.Errorf("decomposition %v: root not projected on its bag, %v", i, got)
+		}
+		y = MakeYannakakis(MakeSearchTree(dec), e2t, data).(*yTree)
+		if ans := y.AllAnswers(); ans == nil || !db.TablesDeepEqual(*ans, *want) {
+			t.Errorf("decomposition %v: answers %v, want %v", i, ans, want)
+		}
+	}
+}
+
+func TestYannakJoins(t *testing.T) {
+	hg, parsed := lib.GetGraph("a(X,Y), b(Y,Z), c(Z,X).")
+	gml := `graph [
+	  node [ id 1 label "{a, b} {X, Y, Z}" ]
+	  node [ id 2 label "{c} {Z, X}" ]
+	  edge [ source 1 target 2 ]
+	]`
+	dec, err := ParseGML(gml, hg, parsed.Encoding)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := db.NewTable([]string{"X", "Y"}, true)
+	a.AddTuples([]db.Tuple{{"1", "2"}, {"2", "3"}, {"3", "1"}})
+	b := db.NewTable([]string{"Y", "Z"}, true)
+	b.AddTuples([]db.Tuple{{"2", "3"}, {"3", "1"}})
+	c := db.NewTable([]string{"Z", "X"}, true)
+	c.AddTuples([]db.Tuple{{"3", "1"}, {"1", "2"}})
+	data := db.Database{"a": a, "b": b, "c": c}
+	e2t := map[int]string{parsed.Encoding["a"]: "a", parsed.Encoding["b"]: "b", parsed.Encoding["c"]: "c"}
+
+	y := MakeYannakakis(MakeSearchTree(dec), e2t, data)
+	if !y.BoolAnswer() {
+		t.Error("the triangle has no answer")
+	}
+	if joins := y.Joins(); len(joins) != 1 || !reflect.DeepEqual(joins[0].Inputs, []int{3, 2}) {
+		t.Errorf("joins %+v, want one of 3 x 2 tuples", joins)
+	}
+}
+
+func TestYannakGenericJoin(t *testing.T) {
+	hg, parsed := lib.GetGraph("a(X,Y), b(Y,Z), c(Z,X).")
+	dec, err := ParseGML(`graph [ node [ id 1 label "{a, b, c} {X, Y, Z}" ] ]`, hg, parsed.Encoding)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := db.NewTable([]string{"X", "Y"}, true)
+	a.AddTuples([]db.Tuple{{"1", "2"}, {"2", "3"}, {"3", "1"}})
+	b := db.NewTable([]string{"Y", "Z"}, true)
+	b.AddTuples([]db.Tuple{{"2", "3"}, {"3", "1"}, {"1", "1"}})
+	c := db.NewTable([]string{"Z", "X"}, true)
+	c.AddTuples([]db.Tuple{{"3", "1"}, {"1", "2"}})
+	data := db.Database{"a": a, "b": b, "c": c}
+	e2t := map[int]string{parsed.Encoding["a"]: "a", parsed.Encoding["b"]: "b", parsed.Encoding["c"]: "c"}
+
+	y := MakeYannakakis(MakeSearchTree(dec), e2t, data)
+	want := db.Join(*db.Join(*a, *b), *c)
+	if got := y.AllAnswers(); got == nil || !db.TablesDeepEqual(*got, *want) {
+		t.Errorf("answers %v, want %v", got, want)
+	}
+	if joins := y.Joins(); len(joins) != 1 || joins[0].Algorithm != db.Generic {
+		t.Errorf("joins %+v, want a generic join", joins)
+	}
+}
+
+// Duplicate tuples do not reach the answers, whether a node is joined by
+// GenericJoin or by a binary operator
+func TestYannakDuplicates(t *testing.T) {
+	hg, parsed := lib.GetGraph("a(X,Y), b(Y,Z), c(Z,X).")
+	a := db.NewTable([]string{"X", "Y"}, false)
+	a.AddTuples([]db.Tuple{{"1", "2"}, {"1", "2"}, {"2", "3"}})
+	b := db.NewTable([]string{"Y", "Z"}, false)
+	b.AddTuples([]db.Tuple{{"2", "3"}, {"3", "1"}, {"3", "1"}})
+	c := db.NewTable([]string{"Z", "X"}, false)
+	c.AddTuples([]db.Tuple{{"3", "1"}, {"1", "2"}, {"1", "2"}})
+	data := db.Database{"a": a, "b": b, "c": c}
+	e2t := map[int]string{parsed.Encoding["a"]: "a", parsed.Encoding["b"]: "b", parsed.Encoding["c"]: "c"}
+	want := db.NewTable([]string{"X", "Y", "Z"}, false)
+	want.AddTuples([]db.Tuple{{"1", "2", "3"}, {"2", "3", "1"}})
+
+	for _, gml := range []string{
+		`graph [ node [ id 1 label "{a, b, c} {X, Y, Z}" ] ]`,
+		`graph [
+		  node [ id 1 label "{a, b} {X, Y, Z}" ]
+		  node [ id 2 label "{c} {Z, X}" ]
+		  edge [ source 1 target 2 ]
+		]`,
+	} {
+		dec, err := ParseGML(gml, hg, parsed.Encoding)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := MakeYannakakis(MakeSearchTree(dec), e2t, data).AllAnswers(); !sameAnswers(got, want) {
+			t.Errorf("%v: answers %v, want %v", gml, got, want)
+		}
+	}
+}
+
+func TestYannakSelfJoin(t *testing.T) {
+	hg, parsed := lib.GetGraph("r1(X,Y), r2(Y,Z).")
+	dec, err := ParseGML(`graph [
+	  node [ id 1 label "{r1} {X, Y}" ]
+	  node [ id 2 label "{r2} {Y, Z}" ]
+	  edge [ source 1 target 2 ]
+	]`, hg, parsed.Encoding)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := db.NewTable([]string{"a", "b"}, true)
+	r.AddTuples([]db.Tuple{{"1", "2"}, {"2", "3"}, {"3", "5"}, {"4", "1"}})
+	data := db.Database{"r1": r.Rename([]string{"X", "Y"}), "r2": r.Rename([]string{"Y", "Z"})}
+	e2t := map[int]string{parsed.Encoding["r1"]: "r1", parsed.Encoding["r2"]: "r2"}
+
+	y := MakeYannakakis(MakeSearchTree(dec), e2t, data)
+	want := db.NewTable([]string{"X", "Y", "Z"}, false)
+	want.AddTuples([]db.Tuple{{"1", "2", "3"}, {"2", "3", "5"}, {"4", "1", "2"}})
+	if got := y.AllAnswers(); got == nil || !db.TablesDeepEqual(*got, *want) {
+		t.Errorf("answers %v, want %v", got, want)
+	}
+	if r.Size() != 4 {
+		t.Errorf("r was reduced to %v tuples", r.Size())
+	}
+}
+
+// vertexTables fills a table for each edge of hg, named after the edge and
+// its vertices, with at most size distinct tuples of random values in [0, n)
+func vertexTables(hg Graph, encoding map[string]int, size int, n int, r *rand.Rand) (db.Database, map[int]string) {
+	names := Names(encoding)
+	data := make(db.Database)
+	e2t := make(map[int]string)
+	for _, e := range hg.Edges.Slice() {
+		attrs := make([]string, len(e.Vertices))
+		for i, v := range e.Vertices {
+			attrs[i] = names[v]
+		}
+		tab := db.NewTable(attrs, false)
+		seen := make(map[string]bool)
+		for i := 0; i < size; i++ {
+			tup := make(db.Tuple, len(attrs))
+			for j := range tup {
+				tup[j] = fmt.Sprint(r.Intn(n))
+			}
+			if !seen[tup.Key()] {
+				seen[tup.Key()] = true
+				tab.AddTuple(tup)
+			}
+		}
+		data[names[e.Name]] = tab
+		e2t[e.Name] = names[e.Name]
+	}
+	return data, e2t
+}
+
+// naiveJoin joins the tables of all the edges of hg
+func naiveJoin(hg Graph, e2t map[int]string, data db.Database) *db.Table {
+	var res *db.Table
+	for _, e := range hg.Edges.Slice() {
+		if res == nil {
+			res = data[e2t[e.Name]].Copy()
+		} else {
+			res = db.Join(*res, *data[e2t[e.Name]])
+		}
+	}
+	return res
+}
+
+// sameAnswers compares the answers of Yannakakis, nil if there are none
+func sameAnswers(got *db.Table, want *db.Table) bool {
+	if got == nil || got.Empty() {
+		return want.Empty()
+	}
+	return db.TablesDeepEqual(*got, *want)
+}
+
+// An edge in a cover, but only partly in its bag, is lost by the projection
+// and must be checked by another node
+func TestYannakPartialCover(t *testing.T) {
+	hg, parsed := lib.GetGraph("e(X,Y), f(X,A), g(Y,B).")
+	dec, err := ParseGML(`graph [
+	  node [ id 1 label "{f, g} {X, Y}" ]
+	  node [ id 2 label "{e} {X}" ]
+	  node [ id 3 label "{f} {X, A}" ]
+	  node [ id 4 label "{g} {Y, B}" ]
+	  edge [ source 1 target 2 ]
+	  edge [ source 1 target 3 ]
+	  edge [ source 1 target 4 ]
+	]`, hg, parsed.Encoding)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := db.NewTable([]string{"X", "Y"}, false)
+	e.AddTuples([]db.Tuple{{"1", "1"}, {"2", "2"}})
+	f := db.NewTable([]string{"X", "A"}, false)
+	f.AddTuples([]db.Tuple{{"1", "a"}, {"2", "b"}})
+	g := db.NewTable([]string{"Y", "B"}, false)
+	g.AddTuples([]db.Tuple{{"1", "c"}, {"2", "d"}})
+	data := db.Database{"e": e, "f": f, "g": g}
+	e2t := map[int]string{parsed.Encoding["e"]: "e", parsed.Encoding["f"]: "f", parsed.Encoding["g"]: "g"}
+
+	want := naiveJoin(hg, e2t, data)
+	if got := MakeYannakakis(MakeSearchTree(dec), e2t, data).AllAnswers(); !sameAnswers(got, want) {
+		t.Errorf("answers %v, want %v", got, want)
+	}
+}
+
+func TestYannakDetKAnswers(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	vertices := "ABCDEF"
+	for inst := 0; inst < 50; inst++ {
+		var edges []string
+		for i := 0; i < 3+r.Intn(3); i++ {
+			perm := r.Perm(len(vertices))[:2+r.Intn(2)]
+			var vs []string
+			for _, p := range perm {
+				vs = append(vs, vertices[p:p+1])
+			}
+			edges = append(edges, fmt.Sprintf("e%v(%v)", i, strings.Join(vs, ",")))
+		}
+		hg, parsed := lib.GetGraph(strings.Join(edges, ", ") + ".")
+		data, e2t := vertexTables(hg, parsed.Encoding, 8, 3, r)
+		want := naiveJoin(hg, e2t, data)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		decomps, _ := (&DetKStreamer{K: 2, Graph: hg}).Stream(ctx)
+		found := 0
+		for dec := range decomps {
+			if got := MakeYannakakis(MakeSearchTree(dec), e2t, data).AllAnswers(); !sameAnswers(got, want) {
+				t.Fatalf("%v with\n%v\nanswers %v, want %v", hg, dec, got, want)
+			}
+			if found++; found == 20 {
+				break
+			}
+		}
+		cancel()
+	}
 }
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/dmlongo/hd-gen/decomp"
+)
+
+var decomposeCmd = command{
+	name:     "decompose",
+	summary:  "Enumerate the decompositions of a hypergraph",
+	required: []string{"width"},
+	flags: func(flagSet *flag.FlagSet) {
+		flagSet.StringVar(&graph, "graph", "", "Hypergraph to decompose (for format see hyperbench.dbai.tuwien.ac.at/downloads/manual.pdf)")
+		flagSet.StringVar(&sqlFile, "sql", "", "Decompose the hypergraph of a select-project-join SQL query instead of -graph")
+		flagSet.StringVar(&datalogFile, "datalog", "", "Decompose the hypergraph of a conjunctive query written as a Datalog rule instead of -graph")
+		flagSet.IntVar(&width, "width", 0, "Width of the decomposition to search for (width > 0)")
+		flagSet.StringVar(&mode, "mode", "enum", "Mode of the generator (enum, best, bnb, rank, opt)")
+		flagSet.StringVar(&gml, "gml", "", "Output the produced decomposition into the specified gml file")
+		flagSet.StringVar(&td, "td", "", "Output the produced decomposition into the specified file in PACE td format")
+		flagSet.StringVar(&htd, "htd", "", "Output the produced decomposition into the specified file in PACE htd format")
+		flagSet.StringVar(&dot, "dot", "", "Output the produced decomposition into the specified file in DOT format, annotated by the evaluator")
+		flagSet.IntVar(&enum, "enum", 0, "Number of decompositions to output (default => all; enum > 0 => min(all, enum))")
+		flagSet.BoolVar(&complete, "complete", false, "Forces the computation of complete decompositions")
+		flagSet.StringVar(&shrink, "shrink", "", "Remove redundant nodes from the produced decomposition (default => none; soft => bag,cover subsets; hard => bag subsets)")
+		flagSet.StringVar(&evaldb, "evaldb", "", "Evaluate decompositions according to a given database")
+		csvFlags(flagSet)
+		flagSet.StringVar(&evaljoin, "evaljoin", "", "Evaluate decompositions according to given join estimates")
+		flagSet.IntVar(&timeout, "timeout", 0, "Set a timeout in milliseconds")
+		flagSet.IntVar(&workers, "workers", workers, "Number of goroutines decomposing independent components at once (enum and best modes)")
+		flagSet.StringVar(&output, "output", outputText, "Output format (text, json => one JSON object per line)")
+	},
+	validate: func() error {
+		if err := validateInput(); err != nil {
+			return err
+		}
+		if width <= 0 {
+			return fmt.Errorf("width must be > 0")
+		}
+		if enum < 0 {
+			return fmt.Errorf("enum must be >= 0")
+		}
+		if timeout < 0 {
+			return fmt.Errorf("timeout must be >= 0")
+		}
+		if workers < 1 {
+			return fmt.Errorf("workers must be >= 1")
+		}
+		if shrink != "" && shrink != decomp.ShrinkSoftly && shrink != decomp.ShrinkHardly {
+			return fmt.Errorf("shrink must be either %v or %v", decomp.ShrinkSoftly, decomp.ShrinkHardly)
+		}
+		if err := validateCSV(); err != nil {
+			return err
+		}
+		if err := validateEvaluator(false); err != nil {
+			return err
+		}
+		if err := validateOutput(); err != nil {
+			return err
+		}
+		if mode != "enum" && mode != "best" && mode != "bnb" && mode != "rank" && mode != "opt" {
+			return fmt.Errorf("mode %v unknown, choose between enum, best, bnb, rank, opt", mode)
+		}
+		if (mode == "best" || mode == "bnb" || mode == "rank" || mode == "opt") && (evaldb == "" && evaljoin == "") {
+			return fmt.Errorf("mode %v requires either evaldb or evaljoin", mode)
+		}
+		return nil
+	},
+	run: runDecompose,
+}
+
+func runDecompose() {
+	hg, encoding, q := loadInput()
+	originalGraph := hg
+
+	ev := loadInputEvaluator(q, hg, encoding)
+
+	var addedVertices []int
+	if complete {
+		addedVertices = hg.MakeEdgesDistinct()
+	}
+
+	solver := newSolver(mode, width, hg, ev)
+
+	ctx, cancel := withTimeout(timeout)
+	defer cancel() // stops the search when -enum is reached
+
+	vNames := decomp.Names(encoding)
+	if output == outputText {
+		fmt.Println("Starting search...")
+	}
+	i := 0
+	start = time.Now()
+	status, searchErr := search(ctx, solver, enum, func(dec Decomp) {
+		durs = append(durs, time.Since(start))
+		if complete {
+			dec.Root.RemoveVertices(addedVertices)
+		}
+		dec.Graph = originalGraph
+		if shrink != "" {
+			tree := decomp.MakeSearchTree(dec)
+			tree.Shrink(shrink)
+			//tree.GreedyJoinOrder(ev.(decomp.InformedEvaluator))
+			dec = decomp.MakeDecomp(*tree)
+		}
+		var gmlSeq string
+		if gml != "" {
+			gmlSeq = gml + "_" + strconv.Itoa(i) + ".gml"
+		}
+		cost := evalCost(ev, dec)
+		var correct bool
+		if output == outputJSON {
+			correct = outputJSONStanza(solver.Name(), i, dec, cost, durs, originalGraph, vNames, gmlSeq, width, false)
+		} else {
+			correct = outputStanza(solver.Name(), i, dec, cost, durs, originalGraph, gmlSeq, width, false, true)
+			fmt.Print("\n\n")
+		}
+		if correct && td != "" {
+			writeFile(td+"_"+strconv.Itoa(i)+".td", decomp.ToTD(dec, vNames))
+		}
+		if correct && htd != "" {
+			writeFile(htd+"_"+strconv.Itoa(i)+".htd", decomp.ToHTD(dec, vNames))
+		}
+		if correct && dot != "" {
+			writeFile(dot+"_"+strconv.Itoa(i)+".dot", decomp.ToDOT(dec, ev, vNames))
+		}
+		i++
+		start = time.Now()
+	})
+	if status != statusLimit {
+		durs = append(durs, time.Since(start))
+	}
+
+	if output == outputJSON {
+		outputJSONSummary(solver, i, durs, width, status, searchErr)
+	} else {
+		fmt.Println("Time Composition: ")
+		for _, t := range durs {
+			fmt.Print(t, "\t")
+		}
+		fmt.Println()
+
+		fmt.Println("\nSearch ended in", sumDurations(durs), "ms.")
+		fmt.Println(i, "decompositions were found.")
+		if scorer, ok := solver.(decomp.Scorer); ok {
+			fmt.Println(scorer.Scored(), "candidates were scored.")
+		}
+		switch status {
+		case statusComplete:
+			fmt.Println("Search was complete.")
+		case statusLimit:
+			fmt.Println("Search was interrupted after", enum, "decompositions.")
+		case statusTimeout:
+			fmt.Println("Search was interrupted by the timeout of", timeout, "ms.")
+		case statusError:
+			fmt.Println("Search failed:", searchErr)
+		}
+	}
+
+	switch status {
+	case statusTimeout:
+		os.Exit(exitTimeout)
+	case statusError:
+		os.Exit(1)
+	}
+}
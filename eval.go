@@ -0,0 +1,180 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/dmlongo/hd-gen/db"
+	"github.com/dmlongo/hd-gen/decomp"
+)
+
+var evalCmd = command{
+	name:     "eval",
+	summary:  "Estimate the cost of existing decompositions and/or execute them on a database",
+	required: []string{"graph"},
+	args:     "[decomposition.gml ...]",
+	flags: func(flagSet *flag.FlagSet) {
+		flagSet.StringVar(&graph, "graph", "", "Hypergraph of the decompositions (for format see hyperbench.dbai.tuwien.ac.at/downloads/manual.pdf)")
+		flagSet.StringVar(&decompFile, "decomp", "", "Decomposition to evaluate, in gml format (more can follow the arguments)")
+		flagSet.StringVar(&evaldb, "evaldb", "", "Evaluate the decompositions according to a given database")
+		flagSet.StringVar(&evaljoin, "evaljoin", "", "Evaluate the decompositions according to given join estimates")
+		flagSet.StringVar(&dot, "dot", "", "Output the decompositions into the specified files in DOT format, annotated by the evaluator")
+		flagSet.StringVar(&dbPath, "db", "", "Execute the decompositions with Yannakakis on a database, whose tables are named as the edges")
+		csvFlags(flagSet)
+		flagSet.BoolVar(&allAnswers, "all", false, "Compute all answers instead of whether one exists")
+		flagSet.StringVar(&output, "output", outputText, "Output format (text, json => one JSON object per line)")
+	},
+	validate: func() error {
+		if decompFile == "" && len(inputs) == 0 {
+			return fmt.Errorf("no decomposition given")
+		}
+		if err := validateCSV(); err != nil {
+			return err
+		}
+		if err := validateEvaluator(dbPath == ""); err != nil {
+			return err
+		}
+		return validateOutput()
+	},
+	run: runEval,
+}
+
+// An external decomposition with its report
+type evaluated struct {
+	source  string
+	correct bool
+	cost    int // < 0 if not estimated
+	exec    time.Duration
+	run     bool
+}
+
+func runEval() {
+	hg, parsedGraph := loadGraph(graph)
+	ev := loadEvaluator(evaldb, evaljoin, hg, parsedGraph.Encoding)
+	files := inputs
+	if decompFile != "" {
+		files = append([]string{decompFile}, files...)
+	}
+
+	var data db.Database
+	var e2t map[int]string
+	if dbPath != "" {
+		data = loadDB(dbPath)
+		data, e2t = edgesToTables(hg, parsedGraph.Encoding, data)
+	}
+
+	var results []evaluated
+	for i, file := range files {
+		dec := readDecomp(file, hg, parsedGraph.Encoding)
+		res := evaluated{source: file, correct: dec.Correct(hg), cost: evalCost(ev, dec)}
+		if dot != "" {
+			writeFile(dot+"_"+strconv.Itoa(i)+".dot", decomp.ToDOT(dec, ev, decomp.Names(parsedGraph.Encoding)))
+		}
+		var answer bool
+		var answers int
+		if dbPath != "" && res.correct { // Yannakakis is only sound on correct decompositions
+			answer, answers, res.exec = execute(dec, data, e2t)
+			res.run = true
+		}
+
+		if output == outputJSON {
+			out := jsonStanza("External", i, dec, res.cost, nil, hg, decomp.Names(parsedGraph.Encoding), dec.CheckWidth(), false, false)
+			out.Source = file
+			if res.run {
+				ms := millis(res.exec)
+				out.ExecMs = &ms
+				if allAnswers {
+					out.Answers = &answers
+				} else {
+					out.Answer = &answer
+				}
+			}
+			printJSON(out)
+		} else {
+			fmt.Println("Source: " + file)
+			outputStanza("External", i, dec, res.cost, nil, hg, "", dec.CheckWidth(), false, false)
+			if res.run {
+				if allAnswers {
+					fmt.Println("Answers: ", answers)
+				} else {
+					fmt.Println("Answer: ", answer)
+				}
+				fmt.Printf("Execution time: %.3f ms\n", millis(res.exec))
+			} else if dbPath != "" {
+				fmt.Println("Not executed, the decomposition is not correct")
+			}
+			fmt.Println()
+		}
+		results = append(results, res)
+	}
+
+	if len(results) > 1 {
+		outputRanking(results)
+	}
+}
+
+// execute runs Yannakakis along dec
+func execute(dec Decomp, data db.Database, e2t map[int]string) (bool, int, time.Duration) {
+	start := time.Now()
+	y := decomp.MakeYannakakis(decomp.MakeSearchTree(dec), e2t, data)
+	if !allAnswers {
+		answer := y.BoolAnswer()
+		return answer, 0, time.Since(start)
+	}
+	answers := 0
+	if ans := y.AllAnswers(); ans != nil {
+		answers = ans.Size()
+	}
+	return answers > 0, answers, time.Since(start)
+}
+
+// outputRanking sorts the decompositions by cost, or by execution time without
+// an evaluator. Incorrect decompositions come last.
+func outputRanking(results []evaluated) {
+	ranked := append([]evaluated(nil), results...)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		a, b := ranked[i], ranked[j]
+		if a.correct != b.correct {
+			return a.correct
+		}
+		if a.cost != b.cost {
+			return a.cost < b.cost
+		}
+		return a.run && b.run && a.exec < b.exec
+	})
+
+	if output == outputJSON {
+		out := jsonRanking{Type: "ranking", Decomps: make([]jsonRanked, 0, len(ranked))}
+		for _, r := range ranked {
+			jr := jsonRanked{Source: r.source, Correct: r.correct}
+			if r.cost >= 0 {
+				cost := r.cost
+				jr.Cost = &cost
+			}
+			if r.run {
+				ms := millis(r.exec)
+				jr.ExecMs = &ms
+			}
+			out.Decomps = append(out.Decomps, jr)
+		}
+		printJSON(out)
+		return
+	}
+	fmt.Println("Ranking:")
+	for i, r := range ranked {
+		line := fmt.Sprintf("%3d. %v", i+1, r.source)
+		if r.cost >= 0 {
+			line += fmt.Sprintf("\tcost %v", r.cost)
+		}
+		if r.run {
+			line += fmt.Sprintf("\texecution %.3f ms", millis(r.exec))
+		}
+		if !r.correct {
+			line += "\tnot correct"
+		}
+		fmt.Println(line)
+	}
+}
@@ -1,22 +1,28 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"os"
-	"reflect"
-	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/cem-okulmus/BalancedGo/lib"
 	"github.com/dmlongo/hd-gen/db"
 	"github.com/dmlongo/hd-gen/decomp"
+	"github.com/dmlongo/hd-gen/query"
 )
 
 var graph string
 var width int
 var gml string
+var td string
+var htd string
+var dot string
 var enum int
 var complete bool
 var shrink string
@@ -24,103 +30,369 @@ var evaldb string
 var evaljoin string
 var mode string
 var timeout int
+var workers = 1
+var output string
+var decompFile string
+var dbPath string
+var allAnswers bool
+var sqlFile string
+var datalogFile string
+var csvSep = ","
+var csvQuote = `"`
+var csvNull string
+var inputs []string // positional arguments of a command
 
 var start time.Time
 var durs []time.Duration
 
+// Outcomes of a search
+const (
+	statusComplete = "complete"
+	statusLimit    = "limit"
+	statusTimeout  = "timeout"
+	statusError    = "error"
+)
+
+// exitTimeout is the exit code of a search interrupted by -timeout
+const exitTimeout = 124
+
 type Graph = lib.Graph
 type Decomp = lib.Decomp
 
 func main() {
-	setFlags()
+	args := os.Args[1:]
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, mainUsage())
+		os.Exit(1)
+	}
+	name := "decompose" // flags without a command keep working as before
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	if name == "help" {
+		if len(args) > 0 {
+			if cmd, ok := findCommand(args[0]); ok {
+				fmt.Println(cmd.usage(cmd.flagSet()))
+				return
+			}
+		}
+		fmt.Println(mainUsage())
+		return
+	}
+	cmd, ok := findCommand(name)
+	if !ok {
+		fmt.Fprint(os.Stderr, "Unknown command ", name, "\n\n", mainUsage(), "\n")
+		os.Exit(1)
+	}
+	cmd.parse(args)
+	cmd.run()
+}
+
+// A command of hd-gen, with its own flags and validation
+type command struct {
+	name     string
+	summary  string
+	required []string // flags that must always be set
+	args     string   // usage of the positional arguments, none allowed if empty
+	flags    func(flagSet *flag.FlagSet)
+	validate func() error
+	run      func()
+}
+
+var commands = []command{decomposeCmd, evalCmd, answerCmd, statsCmd, checkCmd, batchCmd}
+
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
+func (cmd command) flagSet() *flag.FlagSet {
+	flagSet := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	flagSet.SetOutput(ioutil.Discard)
+	cmd.flags(flagSet)
+	return flagSet
+}
+
+// parse sets the flags of cmd from args and validates them, exiting with the usage on errors
+func (cmd command) parse(args []string) {
+	flagSet := cmd.flagSet()
+	err := flagSet.Parse(args)
+	if err == flag.ErrHelp {
+		fmt.Println(cmd.usage(flagSet))
+		os.Exit(0)
+	}
+	if err == nil && flagSet.NArg() > 0 && cmd.args == "" {
+		err = fmt.Errorf("unexpected argument %v", flagSet.Arg(0))
+	}
+	inputs = flagSet.Args()
+	if err == nil {
+		set := make(map[string]bool)
+		flagSet.Visit(func(f *flag.Flag) { set[f.Name] = true })
+		for _, name := range cmd.required {
+			if !set[name] {
+				err = fmt.Errorf("-%v is required", name)
+				break
+			}
+		}
+	}
+	if err == nil && cmd.validate != nil {
+		err = cmd.validate()
+	}
+	if err != nil {
+		fmt.Fprint(os.Stderr, "Error: ", err, "\n\n", cmd.usage(flagSet), "\n")
+		os.Exit(1)
+	}
+}
+
+func (cmd command) usage(flagSet *flag.FlagSet) string {
+	isRequired := func(name string) bool {
+		for _, r := range cmd.required {
+			if r == name {
+				return true
+			}
+		}
+		return false
+	}
+	printFlag := func(f *flag.Flag) string {
+		var out string
+		s := fmt.Sprintf("%T", f.Value) // used to get type of flag
+		if s[6:len(s)-5] != "bool" {
+			out += fmt.Sprintf("  -%-10s \t<%s>\n", f.Name, s[6:len(s)-5])
+		} else {
+			out += fmt.Sprintf("  -%-10s \n", f.Name)
+		}
+		return out + fmt.Sprintln("\t"+f.Usage)
+	}
+
+	out := "Usage of hd-gen " + cmd.name + " (https://github.com/dmlongo/hd-gen)\n"
+	if cmd.args != "" {
+		out += "  hd-gen " + cmd.name + " [arguments] " + cmd.args + "\n"
+	}
+	out += cmd.summary + "\n\n"
+	flagSet.VisitAll(func(f *flag.Flag) {
+		if isRequired(f.Name) {
+			out += printFlag(f)
+		}
+	})
+	out += fmt.Sprintln("\nOptional Arguments: ")
+	flagSet.VisitAll(func(f *flag.Flag) {
+		if !isRequired(f.Name) {
+			out += printFlag(f)
+		}
+	})
+	return out
+}
+
+func mainUsage() string {
+	out := "Usage of hd-gen (https://github.com/dmlongo/hd-gen)\n"
+	out += "  hd-gen <command> [arguments]\n\nCommands:\n"
+	for _, cmd := range commands {
+		out += fmt.Sprintf("  %-10s \t%s\n", cmd.name, cmd.summary)
+	}
+	out += "\nUse \"hd-gen help <command>\" for the arguments of a command.\n"
+	out += "Without a command, the arguments are passed to decompose."
+	return out
+}
+
+// validateEvaluator checks that at most one evaluator is given, exactly one if required
+func validateEvaluator(required bool) error {
+	if evaldb != "" && evaljoin != "" {
+		return fmt.Errorf("choose only one between evaldb and evaljoin")
+	}
+	if required && evaldb == "" && evaljoin == "" {
+		return fmt.Errorf("either evaldb or evaljoin is required")
+	}
+	return nil
+}
+
+func validateOutput() error {
+	if output != outputText && output != outputJSON {
+		return fmt.Errorf("output %v unknown, choose between %v, %v", output, outputText, outputJSON)
+	}
+	return nil
+}
+
+func validateCSV() error {
+	if utf8.RuneCountInString(csvSep) != 1 || csvSep == "\n" || csvSep == csvQuote {
+		return fmt.Errorf("csvsep must be a single character other than csvquote and newline")
+	}
+	if utf8.RuneCountInString(csvQuote) > 1 || csvQuote == "\n" {
+		return fmt.Errorf("csvquote must be a single character other than newline, or empty")
+	}
+	return nil
+}
+
+// csvFlags configures the databases given as directories of CSV files
+func csvFlags(flagSet *flag.FlagSet) {
+	flagSet.StringVar(&csvSep, "csvsep", csvSep, "Separator of the fields of the CSV files of a database directory")
+	flagSet.StringVar(&csvQuote, "csvquote", csvQuote, "Quote of the fields of the CSV files of a database directory (empty => none)")
+	flagSet.StringVar(&csvNull, "null", csvNull, "Marker of missing values in the CSV files of a database directory")
+}
+
+// loadDB reads a database from a file, or from a directory with a CSV file for each table
+func loadDB(path string) db.Database {
+	if info, err := os.Stat(path); err != nil || !info.IsDir() {
+		return db.Load(path)
+	}
+	opts := db.DefaultCSV
+	opts.Comma, _ = utf8.DecodeRuneInString(csvSep)
+	opts.Quote = 0
+	if csvQuote != "" {
+		opts.Quote, _ = utf8.DecodeRuneInString(csvQuote)
+	}
+	opts.Null = csvNull
+	return db.LoadDir(path, opts)
+}
+
+// validateInput checks that exactly one among graph, sql and datalog is given
+func validateInput() error {
+	given := 0
+	for _, input := range []string{graph, sqlFile, datalogFile} {
+		if input != "" {
+			given++
+		}
+	}
+	if given != 1 {
+		return fmt.Errorf("exactly one among graph, sql and datalog is required")
+	}
+	return nil
+}
 
-	dat, err := ioutil.ReadFile(graph)
+// loadInput parses the hypergraph of -graph, or the query of -sql or -datalog with its hypergraph
+func loadInput() (Graph, map[string]int, *query.Query) {
+	path, parse := sqlFile, query.ParseSQL
+	switch {
+	case graph != "":
+		hg, parsedGraph := loadGraph(graph)
+		return hg, parsedGraph.Encoding, nil
+	case datalogFile != "":
+		path, parse = datalogFile, query.ParseDatalog
+	}
+	dat, err := ioutil.ReadFile(path)
 	if err != nil {
 		panic(err)
 	}
-	hg, parsedGraph := lib.GetGraph(string(dat))
-	originalGraph := hg
+	q, err := parse(string(dat))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Can't read %v: %v\n", path, err)
+		os.Exit(1)
+	}
+	return q.Graph, q.Encoding, q
+}
 
-	var ev *decomp.Evaluator
-	if evaldb != "" {
-		db := db.Load(evaldb)
-		sdb := decomp.StatsFromDB(db, hg, parsedGraph.Encoding)
-		ev = &decomp.Evaluator{StatsDB: sdb}
-	} else if evaljoin != "" {
-		sdb := decomp.LoadStatistics(evaljoin, hg, parsedGraph.Encoding)
-		ev = &decomp.Evaluator{StatsDB: sdb}
+// loadInputEvaluator is loadEvaluator, binding the database of evaldb to the atoms of q if any
+func loadInputEvaluator(q *query.Query, hg Graph, encoding map[string]int) *decomp.Evaluator {
+	if q == nil || evaldb == "" {
+		return loadEvaluator(evaldb, evaljoin, hg, encoding)
+	}
+	bound, _, err := q.Bind(loadDB(evaldb))
+	if err != nil {
+		panic(err)
 	}
+	return &decomp.Evaluator{StatsDB: decomp.StatsFromDB(bound, hg, encoding)}
+}
 
-	var addedVertices []int
-	if complete {
-		addedVertices = hg.MakeEdgesDistinct()
+func loadGraph(path string) (Graph, lib.ParseGraph) {
+	dat, err := ioutil.ReadFile(path)
+	if err != nil {
+		panic(err)
 	}
+	return lib.GetGraph(string(dat))
+}
 
-	var solver decomp.Streamer
+// readDecomp parses a decomposition of hg from a GML file
+func readDecomp(path string, hg Graph, encoding map[string]int) Decomp {
+	dat, err := ioutil.ReadFile(path)
+	if err != nil {
+		panic(err)
+	}
+	dec, err := decomp.ParseGML(string(dat), hg, encoding)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Can't read %v: %v\n", path, err)
+		os.Exit(1)
+	}
+	return dec
+}
+
+func loadEvaluator(evaldb string, evaljoin string, hg Graph, encoding map[string]int) *decomp.Evaluator {
+	if evaldb != "" {
+		db := loadDB(evaldb)
+		sdb := decomp.StatsFromDB(db, hg, encoding)
+		return &decomp.Evaluator{StatsDB: sdb}
+	} else if evaljoin != "" {
+		sdb := decomp.LoadStatistics(evaljoin, hg, encoding)
+		return &decomp.Evaluator{StatsDB: sdb}
+	}
+	return nil
+}
+
+func newSolver(mode string, K int, hg Graph, ev *decomp.Evaluator) decomp.Streamer {
 	switch mode {
 	case "enum":
-		solver = &decomp.DetKStreamer{K: width, Graph: hg}
+		return &decomp.DetKStreamer{K: K, Graph: hg, Workers: workers}
 	case "best":
-		detk := &decomp.DetKStreamer{K: width, Graph: hg}
-		solver = &decomp.BestDetKStreamer{DetK: detk, Ev: ev}
+		detk := &decomp.DetKStreamer{K: K, Graph: hg, Workers: workers}
+		return &decomp.BestDetKStreamer{DetK: detk, Ev: ev}
 	case "bnb":
-		solver = &decomp.BnbDetKStreamer{K: width, Graph: hg, Ev: ev}
+		return &decomp.BnbDetKStreamer{K: K, Graph: hg, Ev: ev}
+	case "rank":
+		return &decomp.RankedDetKStreamer{K: K, Graph: hg, Ev: ev}
+	case "opt":
+		return &decomp.OptDetKStreamer{K: K, Graph: hg, Ev: ev}
 	default:
 		panic(fmt.Errorf("mode %v unknown", mode))
 	}
+}
 
-	stop := make(chan bool)
-	if timeout == 0 {
-		defer close(stop)
-	} else {
-		go func() {
-			<-time.After(1 * time.Second)
-			close(stop)
-			// todo problems if program ends for -enum limit before timeout
-		}()
-	}
-
-	fmt.Println("Starting search...")
-	i := 0
-	start = time.Now()
-	for dec := range solver.Stream(stop) {
-		durs = append(durs, time.Since(start))
-		if complete {
-			dec.Root.RemoveVertices(addedVertices)
-		}
-		if !reflect.DeepEqual(dec, Decomp{}) {
-			dec.Graph = originalGraph
-		}
-		if shrink != "" {
-			tree := decomp.MakeSearchTree(dec)
-			tree.Shrink(shrink)
-			//tree.GreedyJoinOrder(ev.(decomp.InformedEvaluator))
-			dec = decomp.MakeDecomp(*tree)
-		}
-		var gmlSeq string
-		if gml != "" {
-			gmlSeq = gml + "_" + strconv.Itoa(i) + ".gml"
-		}
-		outputStanza(solver.Name(), i, dec, ev, durs, originalGraph, gmlSeq, width, false)
-		fmt.Print("\n\n")
-		i++
-		if enum > 0 && i == enum {
-			break
-		}
-		start = time.Now()
-	}
-	if !(enum > 0 && i == enum) {
-		durs = append(durs, time.Since(start))
+// withTimeout returns a context expiring after the given milliseconds (never if 0)
+func withTimeout(ms int) (context.Context, context.CancelFunc) {
+	if ms > 0 {
+		return context.WithTimeout(context.Background(), time.Duration(ms)*time.Millisecond)
 	}
+	return context.WithCancel(context.Background())
+}
 
-	fmt.Println("Time Composition: ")
-	for _, t := range durs {
-		fmt.Print(t, "\t")
+// search passes the decompositions of solver to handle until the search
+// ends, ctx is done or limit decompositions were handled (limit > 0). The
+// search stops right after the last of them, and it is complete only if the
+// stream turns out to be closed already.
+func search(ctx context.Context, solver decomp.Streamer, limit int, handle func(dec Decomp)) (string, error) {
+	stream, errc := solver.Stream(ctx)
+	for i := 0; ; i++ {
+		select {
+		case dec, ok := <-stream:
+			if !ok {
+				return ended(<-errc)
+			}
+			handle(dec)
+			if limit > 0 && i+1 == limit {
+				select {
+				case _, ok := <-stream:
+					if !ok {
+						return ended(<-errc)
+					}
+				default:
+				}
+				return statusLimit, nil
+			}
+		case <-ctx.Done():
+			return statusTimeout, nil
+		}
 	}
-	fmt.Println()
+}
 
-	fmt.Println("\nSearch ended in", sumDurations(durs), "ms.")
-	fmt.Println(i, "decompositions were found.")
+// ended is the status of a search whose stream closed with err
+func ended(err error) (string, error) {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return statusTimeout, nil
+	} else if err != nil {
+		return statusError, err
+	}
+	return statusComplete, nil
 }
 
 func sumDurations(times []time.Duration) int64 {
@@ -131,7 +403,17 @@ func sumDurations(times []time.Duration) int64 {
 	return sumTotal
 }
 
-func outputStanza(algorithm string, i int, decomp Decomp, ev *decomp.Evaluator, times []time.Duration, graph Graph, gml string, K int, skipCheck bool) {
+// evalCost estimates the cost of dec, -1 without an evaluator
+func evalCost(ev *decomp.Evaluator, dec Decomp) int {
+	if ev == nil {
+		return -1
+	}
+	return ev.Eval(dec)
+}
+
+// outputStanza panics on wrong decompositions if strict, otherwise it reports
+// them. A negative cost is not printed. It returns whether decomp is correct.
+func outputStanza(algorithm string, i int, decomp Decomp, cost int, times []time.Duration, graph Graph, gml string, K int, skipCheck bool, strict bool) bool {
 	fmt.Println("Used algorithm: " + algorithm)
 	fmt.Println("Result", i, "( ran with K =", K, ")\n", decomp)
 
@@ -143,95 +425,39 @@ func outputStanza(algorithm string, i int, decomp Decomp, ev *decomp.Evaluator,
 	var correct bool
 	if !skipCheck {
 		correct = decomp.Correct(graph)
-		if !correct {
+		if !correct && strict {
 			panic("wrong decomposition!")
 		}
 	} else {
 		correct = true
 	}
 
-	if ev != nil {
-		fmt.Println("Cost: ", ev.Eval(decomp))
+	if cost >= 0 {
+		fmt.Println("Cost: ", cost)
 	}
 
 	fmt.Println("Correct: ", correct)
 	if correct && len(gml) > 0 {
-		f, err := os.Create(gml)
-		if err != nil {
-			panic(err)
-		}
-
-		defer f.Close()
-		f.WriteString(decomp.ToGML())
-		f.Sync()
+		writeGML(gml, decomp)
 	}
+	return correct
 }
 
-func setFlags() {
-	flagSet := flag.NewFlagSet("", flag.ContinueOnError)
-	flagSet.SetOutput(ioutil.Discard) //todo: see what happens without this line
-
-	flagSet.StringVar(&graph, "graph", "", "Hypergraph to decompose (for format see hyperbench.dbai.tuwien.ac.at/downloads/manual.pdf)")
-	flagSet.IntVar(&width, "width", 0, "Width of the decomposition to search for (width > 0)")
-	flagSet.StringVar(&mode, "mode", "enum", "Mode of the generator (enum, best, bnb)")
-	flagSet.StringVar(&gml, "gml", "", "Output the produced decomposition into the specified gml file")
-	flagSet.IntVar(&enum, "enum", 0, "Number of decompositions to output (default => all; enum > 0 => min(all, enum))")
-	flagSet.BoolVar(&complete, "complete", false, "Forces the computation of complete decompositions")
-	flagSet.StringVar(&shrink, "shrink", "", "Remove redundant nodes from the produced decomposition (default => none; soft => bag,cover subsets; hard => bag subsets)")
-	flagSet.StringVar(&evaldb, "evaldb", "", "Evaluate decompositions according to a given database") // TODO
-	flagSet.StringVar(&evaljoin, "evaljoin", "", "Evaluate decompositions according to given join estimates")
-	flagSet.IntVar(&timeout, "timeout", 0, "Set a timeout in milliseconds")
+func writeGML(path string, decomp Decomp) {
+	writeFile(path, decomp.ToGML())
+}
 
-	parseError := flagSet.Parse(os.Args[1:])
-	if parseError != nil {
-		fmt.Print("Parse Error:\n", parseError.Error(), "\n\n")
+func writeFile(path string, content string) {
+	f, err := os.Create(path)
+	if err != nil {
+		panic(err)
 	}
 
-	if parseError != nil || graph == "" || width <= 0 {
-		out := "Usage of hd-gen (https://github.com/dmlongo/hd-gen)\n"
-		flagSet.VisitAll(func(f *flag.Flag) {
-			if f.Name != "graph" && f.Name != "width" {
-				return
-			}
-			s := fmt.Sprintf("%T", f.Value) // used to get type of flag
-			if s[6:len(s)-5] != "bool" {
-				out += fmt.Sprintf("  -%-10s \t<%s>\n", f.Name, s[6:len(s)-5])
-			} else {
-				out += fmt.Sprintf("  -%-10s \n", f.Name)
-			}
-			out += fmt.Sprintln("\t" + f.Usage)
-		})
-		out += fmt.Sprintln("\nOptional Arguments: ")
-		flagSet.VisitAll(func(f *flag.Flag) {
-			if f.Name == "graph" || f.Name == "width" {
-				return
-			}
-			s := fmt.Sprintf("%T", f.Value) // used to get type of flag
-			if s[6:len(s)-5] != "bool" {
-				out += fmt.Sprintf("  -%-10s \t<%s>\n", f.Name, s[6:len(s)-5])
-			} else {
-				out += fmt.Sprintf("  -%-10s \n", f.Name)
-			}
-			out += fmt.Sprintln("\t" + f.Usage)
-		})
-		fmt.Fprintln(os.Stderr, out)
-
-		if shrink != "" && shrink != decomp.ShrinkSoftly && shrink != decomp.ShrinkHardly {
-			panic(fmt.Errorf("shrink must be either %v or %v", decomp.ShrinkSoftly, decomp.ShrinkHardly))
-		}
-
-		if evaldb != "" && evaljoin != "" {
-			panic(fmt.Errorf("choose only one between evaldb and evaljoin"))
-		}
-
-		if mode != "enum" && mode != "best" && mode != "bnb" {
-			panic(fmt.Errorf("mode %v unknown, choose between enum, best, bnb", mode))
-		}
-
-		if (mode == "best" || mode == "bnb") && (evaldb == "" && evaljoin == "") {
-			panic(fmt.Errorf("mode %v requires either evaldb or evaljoin", mode))
-		}
-
-		os.Exit(1)
+	if _, err := f.WriteString(content); err != nil {
+		f.Close()
+		panic(err)
+	}
+	if err := f.Close(); err != nil {
+		panic(err)
 	}
 }
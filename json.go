@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/cem-okulmus/BalancedGo/lib"
+	"github.com/dmlongo/hd-gen/decomp"
+)
+
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+type jsonNode struct {
+	Bag      []string   `json:"bag"`
+	Cover    []string   `json:"cover"`
+	Children []jsonNode `json:"children,omitempty"`
+}
+
+type jsonDecomp struct {
+	Type      string    `json:"type"`
+	Algorithm string    `json:"algorithm"`
+	Index     int       `json:"index"`
+	K         int       `json:"k"`
+	Width     int       `json:"width"`
+	Cost      *int      `json:"cost,omitempty"`
+	TimeMs    float64   `json:"time_ms"`
+	Correct   bool      `json:"correct"`
+	Tree      *jsonNode `json:"tree"`
+
+	// external decompositions
+	Source  string   `json:"source,omitempty"`
+	Answer  *bool    `json:"answer,omitempty"`
+	Answers *int     `json:"answers,omitempty"`
+	ExecMs  *float64 `json:"exec_ms,omitempty"`
+}
+
+type jsonRanked struct {
+	Source  string   `json:"source"`
+	Cost    *int     `json:"cost,omitempty"`
+	ExecMs  *float64 `json:"exec_ms,omitempty"`
+	Correct bool     `json:"correct"`
+}
+
+type jsonRanking struct {
+	Type    string       `json:"type"`
+	Decomps []jsonRanked `json:"decomps"`
+}
+
+type jsonSummary struct {
+	Type      string    `json:"type"`
+	Algorithm string    `json:"algorithm"`
+	K         int       `json:"k"`
+	Decomps   int       `json:"decomps"`
+	Scored    int       `json:"scored,omitempty"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	TimesMs   []float64 `json:"times_ms"`
+	TotalMs   float64   `json:"total_ms"`
+}
+
+func toJSONNode(n lib.Node, names map[int]string) jsonNode {
+	res := jsonNode{Bag: make([]string, 0, len(n.Bag)), Cover: make([]string, 0, n.Cover.Len())}
+	for _, v := range n.Bag {
+		res.Bag = append(res.Bag, names[v])
+	}
+	for _, e := range n.Cover.Slice() {
+		res.Cover = append(res.Cover, names[e.Name])
+	}
+	for _, c := range n.Children {
+		res.Children = append(res.Children, toJSONNode(c, names))
+	}
+	return res
+}
+
+// millis sums the given durations in fractional milliseconds
+func millis(times ...time.Duration) float64 {
+	var sum time.Duration
+	for _, t := range times {
+		sum += t
+	}
+	return float64(sum) / float64(time.Millisecond)
+}
+
+func printJSON(v interface{}) {
+	line, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Fprintln(os.Stdout, string(line))
+}
+
+func outputJSONStanza(algorithm string, i int, dec Decomp, cost int, times []time.Duration, graph Graph, names map[int]string, gml string, K int, skipCheck bool) bool {
+	out := jsonStanza(algorithm, i, dec, cost, times, graph, names, K, skipCheck, true)
+	printJSON(out)
+
+	if out.Correct && len(gml) > 0 {
+		writeGML(gml, dec)
+	}
+	return out.Correct
+}
+
+// jsonStanza panics on wrong decompositions if strict, otherwise it reports
+// them. A negative cost is omitted.
+func jsonStanza(algorithm string, i int, dec Decomp, cost int, times []time.Duration, graph Graph, names map[int]string, K int, skipCheck bool, strict bool) jsonDecomp {
+	out := jsonDecomp{Type: "decomp", Algorithm: algorithm, Index: i, K: K}
+	out.TimeMs = millis(times...)
+	out.Width = dec.CheckWidth()
+	if !skipCheck {
+		out.Correct = dec.Correct(graph)
+		if !out.Correct && strict {
+			panic("wrong decomposition!")
+		}
+	} else {
+		out.Correct = true
+	}
+	if cost >= 0 {
+		out.Cost = &cost
+	}
+	if dec.Root.Cover.Len() > 0 {
+		tree := toJSONNode(dec.Root, names)
+		out.Tree = &tree
+	}
+	return out
+}
+
+func outputJSONSummary(solver decomp.Streamer, found int, times []time.Duration, K int, status string, err error) {
+	out := jsonSummary{Type: "summary", Algorithm: solver.Name(), K: K, Decomps: found, Status: status}
+	if scorer, ok := solver.(decomp.Scorer); ok {
+		out.Scored = scorer.Scored()
+	}
+	if err != nil {
+		out.Error = err.Error()
+	}
+	out.TimesMs = make([]float64, 0, len(times))
+	for _, t := range times {
+		out.TimesMs = append(out.TimesMs, millis(t))
+	}
+	out.TotalMs = millis(times...)
+	printJSON(out)
+}
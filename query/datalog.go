@@ -0,0 +1,207 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ParseDatalog reads a conjunctive query written as a rule, like
+//
+//	ans(X,Y) :- r(X,Z), s(Z,Y), t(Y,X).
+//
+// Each body atom becomes an edge on the vertices of its variables, named after
+// its relation (r, r_2, ... if the relation is repeated), and binds the columns
+// of the relation by position. Constants select their column and _ ignores it.
+// The head variables are the output of the query, none for a Boolean query.
+func ParseDatalog(rule string) (*Query, error) {
+	tokens, err := datalogTokens(rule)
+	if err != nil {
+		return nil, err
+	}
+	p := &datalogParser{tokens: tokens}
+	head, err := p.atom()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(":-"); err != nil {
+		return nil, err
+	}
+	var body []datalogAtom
+	for {
+		a, err := p.atom()
+		if err != nil {
+			return nil, err
+		}
+		body = append(body, a)
+		if p.peek() != "," {
+			break
+		}
+		p.pos++
+	}
+	if p.peek() == "." {
+		p.pos++
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %v after the rule", p.tokens[p.pos].text)
+	}
+
+	q := &Query{}
+	vars := make(map[string]bool)
+	occurrences := make(map[string]int)
+	for _, a := range body {
+		occurrences[a.name]++
+		atom := Atom{Name: a.name, Relation: a.name}
+		if n := occurrences[a.name]; n > 1 {
+			atom.Name = a.name + "_" + strconv.Itoa(n)
+		}
+		for i, t := range a.terms {
+			col := Column{Pos: i}
+			switch {
+			case t.isVar():
+				col.Vertex = t.text
+				vars[t.text] = true
+			case t.text != "_" || t.quote:
+				col.Consts = []string{t.text}
+			}
+			atom.Columns = append(atom.Columns, col)
+		}
+		q.Atoms = append(q.Atoms, atom)
+	}
+	for _, t := range head.terms {
+		if !t.isVar() {
+			return nil, fmt.Errorf("%v in the head is not a variable", t.text)
+		}
+		if !vars[t.text] {
+			return nil, fmt.Errorf("%v in the head does not occur in the body", t.text)
+		}
+		q.Output = append(q.Output, t.text)
+		q.Header = append(q.Header, t.text)
+	}
+	if err := q.build(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+type datalogToken struct {
+	text  string
+	quote bool
+}
+
+// isVar is true for the named variables, starting with an uppercase letter or _
+func (t datalogToken) isVar() bool {
+	if t.quote || t.text == "_" {
+		return false
+	}
+	c := []rune(t.text)[0]
+	return c == '_' || unicode.IsUpper(c)
+}
+
+type datalogAtom struct {
+	name  string
+	terms []datalogToken
+}
+
+type datalogParser struct {
+	tokens []datalogToken
+	pos    int
+}
+
+func datalogTokens(rule string) ([]datalogToken, error) {
+	var res []datalogToken
+	in := []rune(rule)
+	for i := 0; i < len(in); {
+		c := in[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '%': // comment until the end of the line
+			for i < len(in) && in[i] != '\n' {
+				i++
+			}
+		case c == '"' || c == '\'':
+			j := i + 1
+			for j < len(in) && in[j] != c {
+				j++
+			}
+			if j >= len(in) {
+				return nil, fmt.Errorf("unterminated string at %v", i)
+			}
+			res = append(res, datalogToken{text: string(in[i+1 : j]), quote: true})
+			i = j + 1
+		case c == ':' && i+1 < len(in) && in[i+1] == '-':
+			res = append(res, datalogToken{text: ":-"})
+			i += 2
+		case strings.ContainsRune("(),.", c):
+			res = append(res, datalogToken{text: string(c)})
+			i++
+		case c == '_' || c == '-' || unicode.IsLetter(c) || unicode.IsDigit(c):
+			j := i + 1
+			for j < len(in) && (in[j] == '_' || unicode.IsLetter(in[j]) || unicode.IsDigit(in[j]) ||
+				(in[j] == '.' && unicode.IsDigit(in[j-1]) && j+1 < len(in) && unicode.IsDigit(in[j+1]))) {
+				j++
+			}
+			res = append(res, datalogToken{text: string(in[i:j])})
+			i = j
+		default:
+			return nil, fmt.Errorf("unexpected %q at %v", c, i)
+		}
+	}
+	return res, nil
+}
+
+func (p *datalogParser) peek() string {
+	if p.pos < len(p.tokens) && !p.tokens[p.pos].quote {
+		return p.tokens[p.pos].text
+	}
+	return ""
+}
+
+func (p *datalogParser) expect(symbol string) error {
+	if p.peek() != symbol {
+		if p.pos >= len(p.tokens) {
+			return fmt.Errorf("expected %v at the end of the rule", symbol)
+		}
+		return fmt.Errorf("expected %v, found %v", symbol, p.tokens[p.pos].text)
+	}
+	p.pos++
+	return nil
+}
+
+// atom reads name(term, ...), or just name without terms
+func (p *datalogParser) atom() (datalogAtom, error) {
+	var a datalogAtom
+	if p.pos >= len(p.tokens) {
+		return a, fmt.Errorf("expected an atom at the end of the rule")
+	}
+	name := p.tokens[p.pos]
+	if name.quote || !isIdent(name.text) {
+		return a, fmt.Errorf("%v is not the name of a relation", name.text)
+	}
+	a.name = name.text
+	p.pos++
+	if p.peek() != "(" {
+		return a, nil
+	}
+	p.pos++
+	for p.peek() != ")" {
+		if p.pos >= len(p.tokens) {
+			return a, fmt.Errorf("missing ) in %v", a.name)
+		}
+		t := p.tokens[p.pos]
+		if !t.quote && (t.text == "(" || t.text == "," || t.text == "." || t.text == ":-") {
+			return a, fmt.Errorf("unexpected %v in %v", t.text, a.name)
+		}
+		a.terms = append(a.terms, t)
+		p.pos++
+		if p.peek() == "," {
+			p.pos++
+		} else if p.peek() != ")" {
+			return a, fmt.Errorf("missing ) in %v", a.name)
+		}
+	}
+	p.pos++
+	return a, nil
+}
@@ -0,0 +1,88 @@
+package query
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dmlongo/hd-gen/db"
+)
+
+func TestParseDatalog(t *testing.T) {
+	q, err := ParseDatalog("ans(X,Y) :- r(X,Z), s(Z,Y), r(Y,X).")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names, relations []string
+	for _, a := range q.Atoms {
+		names = append(names, a.Name)
+		relations = append(relations, a.Relation)
+	}
+	if !reflect.DeepEqual(names, []string{"r", "s", "r_2"}) || !reflect.DeepEqual(relations, []string{"r", "s", "r"}) {
+		t.Errorf("atoms %v of relations %v", names, relations)
+	}
+	if want := []Column{{Pos: 0, Vertex: "Y"}, {Pos: 1, Vertex: "X"}}; !reflect.DeepEqual(q.Atoms[2].Columns, want) {
+		t.Errorf("r_2 binds %+v, want %+v", q.Atoms[2].Columns, want)
+	}
+	if !reflect.DeepEqual(q.Output, []string{"X", "Y"}) {
+		t.Errorf("output %v", q.Output)
+	}
+	if q.Graph.Edges.Len() != 3 || len(q.Graph.Vertices()) != 3 {
+		t.Errorf("hypergraph %v", q.Graph)
+	}
+}
+
+func TestDatalogAnswers(t *testing.T) {
+	q, err := ParseDatalog("ans(Z, X) :- r(X, Y), s(Y, Z), r(_, Y), s(Y, \"a\").")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bound, _, err := q.Bind(testDB())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bound["s_2"].Size() != 1 || bound["r_2"].Size() != 2 {
+		t.Errorf("s_2 has %v tuples, r_2 %v", bound["s_2"].Size(), bound["r_2"].Size())
+	}
+	joined := db.Join(*db.Join(*db.Join(*bound["r"], *bound["s"]), *bound["r_2"]), *bound["s_2"])
+	want := []db.Tuple{{"a", "1"}, {"b", "1"}, {"a", "2"}, {"b", "2"}}
+	got := q.Answers(joined)
+	if len(got) != len(want) {
+		t.Fatalf("answers %v, want %v", got, want)
+	}
+	for _, w := range want {
+		found := false
+		for _, g := range got {
+			found = found || db.TuplesEqual(g, w)
+		}
+		if !found {
+			t.Errorf("answer %v missing in %v", w, got)
+		}
+	}
+}
+
+func TestParseDatalogErrors(t *testing.T) {
+	tests := []struct {
+		rule string
+		want string
+	}{
+		{"ans(X) :- r(Y, Z).", "does not occur"},
+		{"ans(a) :- r(X, a).", "not a variable"},
+		{"ans(X) r(X, Y).", "expected :-"},
+		{"ans(X) :- r(X, Y", "missing )"},
+		{"ans(X) :- r(X, Y), .", "not the name of a relation"},
+		{"ans(X) :- r(X, \"a).", "unterminated"},
+		{"ans(X) :- r(X, _).", ""},
+		{"ans :- r(a, b).", "cross products"},
+	}
+	for _, test := range tests {
+		_, err := ParseDatalog(test.rule)
+		if test.want == "" {
+			if err != nil {
+				t.Errorf("%v: %v", test.rule, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%v: got %v, want %v", test.rule, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cem-okulmus/BalancedGo/lib"
+	"github.com/dmlongo/hd-gen/db"
+)
+
+// Query is a conjunctive query over the tables of a database.
+// Its hypergraph has an edge for each atom and a vertex for each
+// class of columns that the query equates.
+type Query struct {
+	Atoms  []Atom
+	Output []string // vertices of the answers, in order
+	Header []string // names of the columns of the answers
+	Star   bool     // output every column of the atoms, set by Bind
+
+	Graph    lib.Graph
+	Encoding map[string]int
+}
+
+// Atom is an occurrence of a relation in the query
+type Atom struct {
+	Name     string // name of the edge, unique in the query
+	Relation string // table of the database
+	Columns  []Column
+}
+
+// Column binds a column of a relation, by name or by position if Name is empty
+type Column struct {
+	Name   string
+	Pos    int
+	Vertex string   // empty if the column is only selected
+	Consts []string // values the column must be equal to
+}
+
+// build parses the hypergraph of q
+func (q *Query) build() error {
+	var edges []string
+	names := make(map[string]bool)
+	for _, a := range q.Atoms {
+		if names[a.Name] {
+			return fmt.Errorf("%v is not unique", a.Name)
+		}
+		names[a.Name] = true
+	}
+	for _, a := range q.Atoms {
+		var vertices []string
+		seen := make(map[string]bool)
+		for _, c := range a.Columns {
+			if c.Vertex != "" && !seen[c.Vertex] {
+				if names[c.Vertex] {
+					return fmt.Errorf("%v is the name of both an atom and a vertex", c.Vertex)
+				}
+				seen[c.Vertex] = true
+				vertices = append(vertices, c.Vertex)
+			}
+		}
+		if len(vertices) == 0 {
+			return fmt.Errorf("%v joins no column, cross products are not supported", a.Name)
+		}
+		edges = append(edges, a.Name+"("+strings.Join(vertices, ",")+")")
+	}
+	if len(edges) == 0 {
+		return fmt.Errorf("the query has no atom")
+	}
+	var parsed lib.ParseGraph
+	q.Graph, parsed = lib.GetGraph(strings.Join(edges, ",\n") + ".")
+	q.Encoding = parsed.Encoding
+	return nil
+}
+
+// Bind computes a table for each atom from the tables of d, renaming the
+// columns into vertices and applying the selections of the query. The
+// result is named after the atoms and maps each edge to its table. If q is
+// Star, Bind sets its output to the columns of the tables, which the query
+// must all mention, since the hypergraph has no vertex for the others.
+func (q *Query) Bind(d db.Database) (db.Database, map[int]string, error) {
+	res := make(db.Database)
+	e2t := make(map[int]string)
+	if q.Star {
+		q.Output, q.Header = nil, nil
+	}
+	for _, a := range q.Atoms {
+		tab, ok := d[a.Relation]
+		if !ok {
+			return nil, nil, fmt.Errorf("no table %v for %v", a.Relation, a.Name)
+		}
+		pos := make([]int, len(a.Columns))
+		var attrs []string
+		vertexPos := make(map[string]int) // first column of each vertex
+		for i, c := range a.Columns {
+			if c.Name != "" {
+				p, ok := tab.Position(c.Name)
+				if !ok {
+					return nil, nil, fmt.Errorf("table %v has no column %v", a.Relation, c.Name)
+				}
+				pos[i] = p
+			} else {
+				if c.Pos < 0 || c.Pos >= len(tab.Attributes()) {
+					return nil, nil, fmt.Errorf("table %v has %v columns, %v are used", a.Relation, len(tab.Attributes()), c.Pos+1)
+				}
+				pos[i] = c.Pos
+			}
+			if _, ok := vertexPos[c.Vertex]; c.Vertex != "" && !ok {
+				vertexPos[c.Vertex] = pos[i]
+				attrs = append(attrs, c.Vertex)
+			}
+		}
+
+		if q.Star {
+			if err := q.expandStar(a, tab); err != nil {
+				return nil, nil, err
+			}
+		}
+
+		types := make([]db.Type, len(attrs))
+		for i, v := range attrs {
+			types[i] = tab.Types()[vertexPos[v]]
+		}
+		consts := make([][]db.Value, len(a.Columns))
+		for i, c := range a.Columns {
+			for _, s := range c.Consts {
+				val, err := db.ParseValue(tab.Types()[pos[i]], s)
+				if err != nil {
+					return nil, nil, fmt.Errorf("%v is not a valid %v for column %v of %v", s, tab.Types()[pos[i]], i+1, a.Relation)
+				}
+				consts[i] = append(consts[i], val)
+			}
+		}
+
+		bound := db.NewDictTable(attrs, types, tab.Dict(), true)
+		seen := make(map[string]bool)
+	tuples:
+		for j := 0; j < tab.Size(); j++ {
+			tup := tab.Tuple(j)
+			for i, c := range a.Columns {
+				for _, val := range consts[i] {
+					if tup[pos[i]] != val {
+						continue tuples
+					}
+				}
+				if p := vertexPos[c.Vertex]; c.Vertex != "" && (tup[pos[i]] != tup[p] || tup[p] == db.Null && pos[i] != p) {
+					continue tuples
+				}
+			}
+			newTup := make(db.Tuple, len(attrs))
+			for i, v := range attrs {
+				newTup[i] = tup[vertexPos[v]]
+			}
+			if key := newTup.Key(); !seen[key] {
+				seen[key] = true
+				bound.AddTuple(newTup)
+			}
+		}
+		res[a.Name] = bound
+		e2t[q.Encoding[a.Name]] = a.Name
+	}
+	return res, e2t, nil
+}
+
+// expandStar outputs the columns of the table of a in the order of its schema
+func (q *Query) expandStar(a Atom, tab *db.Table) error {
+	for _, attr := range tab.Attributes() {
+		vertex := ""
+		for _, c := range a.Columns {
+			if c.Name == attr {
+				vertex = c.Vertex
+				break
+			}
+		}
+		if vertex == "" {
+			return fmt.Errorf("SELECT * outputs %v.%v, which the query does not mention, list the columns instead", a.Name, attr)
+		}
+		q.Output = append(q.Output, vertex)
+		q.Header = append(q.Header, a.Name+"."+attr)
+	}
+	return nil
+}
+
+// Answers projects the answers computed over the hypergraph of q on its output
+func (q *Query) Answers(t *db.Table) []db.Tuple {
+	if t == nil {
+		return nil
+	}
+	pos := make([]int, len(q.Output))
+	for i, v := range q.Output {
+		p, ok := t.Position(v)
+		if !ok {
+			panic(fmt.Errorf("answers have no column %v", v))
+		}
+		pos[i] = p
+	}
+	var res []db.Tuple
+	seen := make(map[string]bool)
+	for j := 0; j < t.Size(); j++ {
+		tup := t.Tuple(j)
+		newTup := make(db.Tuple, len(pos))
+		for i, p := range pos {
+			newTup[i] = tup[p]
+		}
+		if key := newTup.Key(); !seen[key] {
+			seen[key] = true
+			res = append(res, newTup)
+		}
+	}
+	return res
+}
@@ -0,0 +1,384 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// ParseSQL reads a select-project-join query of the form
+//
+//	SELECT [DISTINCT] * | a.x, ... FROM r1 [AS] a, ... [WHERE a.x = b.y AND a.z = 'c' ...]
+//
+// Columns equated by the query form the vertices of its hypergraph, named
+// after their first column in the query. SELECT * outputs every column of
+// the tables, which Bind expands against their schema.
+func ParseSQL(sql string) (*Query, error) {
+	p := &sqlParser{}
+	if err := p.tokenize(sql); err != nil {
+		return nil, err
+	}
+	if err := p.parse(); err != nil {
+		return nil, err
+	}
+	return p.query()
+}
+
+type sqlToken struct {
+	text  string
+	quote bool // a string constant
+}
+
+// sqlCol is a column of an atom, as alias.name
+type sqlCol struct {
+	alias string
+	name  string
+}
+
+func (c sqlCol) String() string {
+	return c.alias + "." + c.name
+}
+
+type sqlParser struct {
+	tokens []sqlToken
+	pos    int
+
+	star    bool
+	selects []sqlCol
+	aliases []string
+	tables  map[string]string // alias => relation
+
+	cols   []sqlCol // in order of appearance
+	parent map[sqlCol]sqlCol
+	consts map[sqlCol][]string
+}
+
+func (p *sqlParser) tokenize(sql string) error {
+	in := []rune(sql)
+	for i := 0; i < len(in); {
+		c := in[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '\'':
+			var val strings.Builder
+			j := i + 1
+			for ; j < len(in); j++ {
+				if in[j] == '\'' {
+					if j+1 < len(in) && in[j+1] == '\'' { // escaped quote
+						val.WriteRune('\'')
+						j++
+						continue
+					}
+					break
+				}
+				val.WriteRune(in[j])
+			}
+			if j >= len(in) {
+				return fmt.Errorf("unterminated string at %v", i)
+			}
+			p.tokens = append(p.tokens, sqlToken{text: val.String(), quote: true})
+			i = j + 1
+		case strings.ContainsRune(",.=*;", c):
+			p.tokens = append(p.tokens, sqlToken{text: string(c)})
+			i++
+		case c == '_' || c == '-' || c == '+' || unicode.IsLetter(c) || unicode.IsDigit(c):
+			// a number, possibly signed, may have a decimal point
+			num := unicode.IsDigit(c) || (c == '-' || c == '+') && i+1 < len(in) && unicode.IsDigit(in[i+1])
+			j := i + 1
+			for j < len(in) && (in[j] == '_' || unicode.IsLetter(in[j]) || unicode.IsDigit(in[j]) ||
+				(in[j] == '.' && num && j+1 < len(in) && unicode.IsDigit(in[j+1]))) {
+				j++
+			}
+			p.tokens = append(p.tokens, sqlToken{text: string(in[i:j])})
+			i = j
+		default:
+			return fmt.Errorf("unexpected %q at %v, only conjunctions of equalities are supported", c, i)
+		}
+	}
+	return nil
+}
+
+func (p *sqlParser) peek() string {
+	if p.pos < len(p.tokens) && !p.tokens[p.pos].quote {
+		return strings.ToUpper(p.tokens[p.pos].text)
+	}
+	return ""
+}
+
+func (p *sqlParser) expect(keyword string) error {
+	if p.peek() != keyword {
+		if p.pos >= len(p.tokens) {
+			return fmt.Errorf("expected %v at the end of the query", keyword)
+		}
+		return fmt.Errorf("expected %v, found %v", keyword, p.tokens[p.pos].text)
+	}
+	p.pos++
+	return nil
+}
+
+// until returns the tokens up to one of the keywords (excluded)
+func (p *sqlParser) until(keywords ...string) []sqlToken {
+	start := p.pos
+	for p.pos < len(p.tokens) {
+		for _, k := range keywords {
+			if p.peek() == k {
+				return p.tokens[start:p.pos]
+			}
+		}
+		p.pos++
+	}
+	return p.tokens[start:]
+}
+
+func (p *sqlParser) parse() error {
+	p.tables = make(map[string]string)
+	p.parent = make(map[sqlCol]sqlCol)
+	p.consts = make(map[sqlCol][]string)
+
+	if err := p.expect("SELECT"); err != nil {
+		return err
+	}
+	if p.peek() == "DISTINCT" {
+		p.pos++
+	}
+	selectList := p.until("FROM")
+	if err := p.expect("FROM"); err != nil {
+		return err
+	}
+	if err := p.parseFrom(p.until("WHERE", ";")); err != nil {
+		return err
+	}
+
+	if len(selectList) == 1 && selectList[0].text == "*" && !selectList[0].quote {
+		p.star = true
+	} else {
+		for _, item := range split(selectList, ",") {
+			col, err := p.column(item)
+			if err != nil {
+				return err
+			}
+			p.selects = append(p.selects, col)
+		}
+	}
+
+	if p.peek() == "WHERE" {
+		p.pos++
+		for _, cond := range split(p.until(";"), "AND") {
+			if err := p.parseCondition(cond); err != nil {
+				return err
+			}
+		}
+	}
+	if p.peek() == ";" {
+		p.pos++
+	}
+	if p.pos < len(p.tokens) {
+		return fmt.Errorf("unexpected %v after the query", p.tokens[p.pos].text)
+	}
+	return nil
+}
+
+func (p *sqlParser) parseFrom(tokens []sqlToken) error {
+	items := split(tokens, ",")
+	if len(items) == 0 {
+		return fmt.Errorf("no table in FROM")
+	}
+	for _, item := range items {
+		var relation, alias string
+		switch {
+		case len(item) == 1:
+			relation, alias = item[0].text, item[0].text
+		case len(item) == 2:
+			relation, alias = item[0].text, item[1].text
+		case len(item) == 3 && strings.ToUpper(item[1].text) == "AS":
+			relation, alias = item[0].text, item[2].text
+		default:
+			return fmt.Errorf("%v is not a table, only comma separated tables are supported", join(item))
+		}
+		if !isIdent(relation) || !isIdent(alias) {
+			return fmt.Errorf("%v is not a table", join(item))
+		}
+		if _, ok := p.tables[alias]; ok {
+			return fmt.Errorf("%v is not unique in FROM", alias)
+		}
+		p.tables[alias] = relation
+		p.aliases = append(p.aliases, alias)
+	}
+	return nil
+}
+
+// column resolves alias.name, or name if FROM has a single table
+func (p *sqlParser) column(tokens []sqlToken) (sqlCol, error) {
+	var col sqlCol
+	switch {
+	case len(tokens) == 3 && tokens[1].text == "." && !tokens[1].quote:
+		col = sqlCol{alias: tokens[0].text, name: tokens[2].text}
+		if _, ok := p.tables[col.alias]; !ok {
+			return col, fmt.Errorf("%v is not a table in FROM", col.alias)
+		}
+	case len(tokens) == 1 && isIdent(tokens[0].text) && !tokens[0].quote:
+		if len(p.aliases) > 1 {
+			return col, fmt.Errorf("column %v must be qualified with its table", tokens[0].text)
+		}
+		col = sqlCol{alias: p.aliases[0], name: tokens[0].text}
+	default:
+		return col, fmt.Errorf("%v is not a column", join(tokens))
+	}
+	if !isIdent(col.name) {
+		return col, fmt.Errorf("%v is not a column", join(tokens))
+	}
+	if _, ok := p.parent[col]; !ok {
+		p.parent[col] = col
+		p.cols = append(p.cols, col)
+	}
+	return col, nil
+}
+
+func (p *sqlParser) parseCondition(tokens []sqlToken) error {
+	sides := split(tokens, "=")
+	if len(sides) != 2 {
+		return fmt.Errorf("%v is not an equality", join(tokens))
+	}
+	var cols []sqlCol
+	var consts []string
+	for _, side := range sides {
+		if len(side) == 1 && (side[0].quote || isNumber(side[0].text)) {
+			consts = append(consts, side[0].text)
+			continue
+		}
+		col, err := p.column(side)
+		if err != nil {
+			return err
+		}
+		cols = append(cols, col)
+	}
+	switch len(cols) {
+	case 2:
+		p.union(cols[0], cols[1])
+	case 1:
+		p.consts[cols[0]] = append(p.consts[cols[0]], consts[0])
+	default:
+		return fmt.Errorf("%v compares two constants", join(tokens))
+	}
+	return nil
+}
+
+func (p *sqlParser) find(c sqlCol) sqlCol {
+	for p.parent[c] != c {
+		c = p.parent[c]
+	}
+	return c
+}
+
+// union keeps as representative the column that appeared first
+func (p *sqlParser) union(a sqlCol, b sqlCol) {
+	ra, rb := p.find(a), p.find(b)
+	if ra == rb {
+		return
+	}
+	for _, c := range p.cols {
+		if c == ra {
+			p.parent[rb] = ra
+			return
+		} else if c == rb {
+			p.parent[ra] = rb
+			return
+		}
+	}
+}
+
+// query builds the atoms from the classes of columns
+func (p *sqlParser) query() (*Query, error) {
+	size := make(map[sqlCol]int)
+	classConsts := make(map[sqlCol][]string)
+	for _, c := range p.cols {
+		r := p.find(c)
+		size[r]++
+		classConsts[r] = append(classConsts[r], p.consts[c]...)
+	}
+	selected := make(map[sqlCol]bool)
+	for _, c := range p.selects {
+		selected[p.find(c)] = true
+	}
+	// a column is a vertex if it is joined or output
+	vertex := func(c sqlCol) string {
+		r := p.find(c)
+		if size[r] > 1 || selected[r] || p.star {
+			return r.String()
+		}
+		return ""
+	}
+
+	q := &Query{}
+	for _, alias := range p.aliases {
+		a := Atom{Name: alias, Relation: p.tables[alias]}
+		for _, c := range p.cols {
+			if c.alias == alias {
+				a.Columns = append(a.Columns, Column{Name: c.name, Vertex: vertex(c), Consts: classConsts[p.find(c)]})
+			}
+		}
+		q.Atoms = append(q.Atoms, a)
+	}
+	q.Star = p.star
+	for _, c := range p.selects {
+		q.Output = append(q.Output, vertex(c))
+		q.Header = append(q.Header, c.String())
+	}
+	if err := q.build(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// split separates tokens by a symbol or keyword
+func split(tokens []sqlToken, sep string) [][]sqlToken {
+	var res [][]sqlToken
+	start := 0
+	for i, t := range tokens {
+		if !t.quote && strings.ToUpper(t.text) == sep {
+			res = append(res, tokens[start:i])
+			start = i + 1
+		}
+	}
+	if len(tokens) > 0 {
+		res = append(res, tokens[start:])
+	}
+	return res
+}
+
+func join(tokens []sqlToken) string {
+	var texts []string
+	for _, t := range tokens {
+		texts = append(texts, t.text)
+	}
+	return strings.Join(texts, " ")
+}
+
+func isIdent(s string) bool {
+	if s == "" || unicode.IsDigit([]rune(s)[0]) {
+		return false
+	}
+	for _, c := range s {
+		if c != '_' && !unicode.IsLetter(c) && !unicode.IsDigit(c) {
+			return false
+		}
+	}
+	return true
+}
+
+func isNumber(s string) bool {
+	s = strings.TrimLeft(s, "+-")
+	if s == "" {
+		return false
+	}
+	dot := false
+	for _, c := range s {
+		if c == '.' && !dot {
+			dot = true
+		} else if !unicode.IsDigit(c) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,189 @@
+package query
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dmlongo/hd-gen/db"
+)
+
+func testDB() db.Database {
+	r := db.NewTable([]string{"x", "y"}, true)
+	r.AddTuples([]db.Tuple{{"1", "2"}, {"2", "2"}, {"3", "3"}})
+	s := db.NewTable([]string{"y", "z"}, true)
+	s.AddTuples([]db.Tuple{{"2", "a"}, {"3", "b"}, {"2", "b"}})
+	return db.Database{"r": r, "s": s}
+}
+
+func TestParseSQL(t *testing.T) {
+	q, err := ParseSQL("SELECT a.x, s.z FROM r a, s WHERE a.y = s.y AND s.z = 'b';")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Atom{
+		{Name: "a", Relation: "r", Columns: []Column{{Name: "x", Vertex: "a.x"}, {Name: "y", Vertex: "a.y"}}},
+		{Name: "s", Relation: "s", Columns: []Column{{Name: "z", Vertex: "s.z", Consts: []string{"b"}}, {Name: "y", Vertex: "a.y"}}},
+	}
+	if !reflect.DeepEqual(q.Atoms, want) {
+		t.Errorf("atoms %+v, want %+v", q.Atoms, want)
+	}
+	if !reflect.DeepEqual(q.Output, []string{"a.x", "s.z"}) || !reflect.DeepEqual(q.Header, []string{"a.x", "s.z"}) {
+		t.Errorf("output %v with header %v", q.Output, q.Header)
+	}
+	if q.Graph.Edges.Len() != 2 || len(q.Graph.Vertices()) != 3 {
+		t.Errorf("hypergraph %v", q.Graph)
+	}
+
+	q, err = ParseSQL("SELECT r.x FROM r WHERE r.x = -1.5 AND r.y = -2 AND r.z = 2.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var consts []string
+	for _, c := range q.Atoms[0].Columns {
+		consts = append(consts, c.Consts...)
+	}
+	if want := []string{"-1.5", "-2", "2.5"}; !reflect.DeepEqual(consts, want) {
+		t.Errorf("constants %v, want %v", consts, want)
+	}
+}
+
+func TestBindSelfJoin(t *testing.T) {
+	q, err := ParseSQL("select r1.x, r2.x from r r1, r r2, s where r1.y = r2.x and r1.y = s.y and s.z = 'a'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bound, e2t, err := q.Bind(testDB())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bound) != 3 || len(e2t) != 3 {
+		t.Fatalf("bound %v tables for %v edges", len(bound), len(e2t))
+	}
+	if got := bound["r2"].Attributes(); !reflect.DeepEqual(got, []string{"r2.x"}) {
+		t.Errorf("r2 has attributes %v", got)
+	}
+	if bound["s"].Size() != 1 { // s.z = 'a', projected on y
+		t.Errorf("s has %v tuples, want 1", bound["s"].Size())
+	}
+	for e, tab := range e2t {
+		if q.Encoding[tab] != e {
+			t.Errorf("edge %v is mapped to %v", e, tab)
+		}
+	}
+}
+
+func TestBindSameAtom(t *testing.T) {
+	q, err := ParseSQL("SELECT * FROM r WHERE x = y")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bound, _, err := q.Bind(testDB())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := bound["r"]; got.Size() != 2 || len(got.Attributes()) != 1 {
+		t.Errorf("r is %v", got)
+	}
+}
+
+func TestBindDict(t *testing.T) {
+	d := testDB()
+	if d["r"].Dict() == d["s"].Dict() {
+		t.Error("tables created apart share a dictionary")
+	}
+	q, err := ParseSQL("SELECT r.x FROM r, s WHERE r.y = s.y")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bound, _, err := q.Bind(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"r", "s"} {
+		if bound[name].Dict() != d[name].Dict() {
+			t.Errorf("%v is bound with another dictionary", name)
+		}
+	}
+}
+
+func TestBindStar(t *testing.T) {
+	q, err := ParseSQL("SELECT * FROM r, s WHERE r.y = s.y AND s.z = 'b' AND r.x = r.x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := q.Bind(testDB()); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"r.x", "r.y", "s.y", "s.z"}; !reflect.DeepEqual(q.Header, want) {
+		t.Errorf("header %v, want %v", q.Header, want)
+	}
+	if want := []string{"r.x", "r.y", "r.y", "s.z"}; !reflect.DeepEqual(q.Output, want) {
+		t.Errorf("output %v, want %v", q.Output, want)
+	}
+
+	q, err = ParseSQL("SELECT * FROM r, s WHERE r.y = s.y")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := q.Bind(testDB()); err == nil || !strings.Contains(err.Error(), "r.x") {
+		t.Errorf("got %v, want an error on r.x", err)
+	}
+}
+
+func TestParseSQLErrors(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want string
+	}{
+		{"SELECT x FROM r, s WHERE r.y = s.y", "must be qualified"},
+		{"SELECT r.x FROM r, s WHERE r.y = t.y", "t is not a table"},
+		{"SELECT r.x FROM r, s WHERE r.y < s.y", "unexpected '<'"},
+		{"SELECT r.x FROM r a, s a WHERE a.y = a.y", "not unique"},
+		{"SELECT r.x FROM r, s", "cross products"},
+		{"SELECT r.x FROM r WHERE 1 = 1", "two constants"},
+		{"SELECT r.x FROM r WHERE r.x = 'a", "unterminated"},
+		{"SELECT r.x r WHERE r.x = 1", "expected FROM"},
+	}
+	for _, test := range tests {
+		if _, err := ParseSQL(test.sql); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%v: got %v, want %v", test.sql, err, test.want)
+		}
+	}
+}
+
+func TestBindErrors(t *testing.T) {
+	for _, sql := range []string{"SELECT u.x FROM u", "SELECT r.w FROM r"} {
+		q, err := ParseSQL(sql)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := q.Bind(testDB()); err == nil {
+			t.Errorf("%v: bound a missing table or column", sql)
+		}
+	}
+}
+
+func TestBindTypes(t *testing.T) {
+	r := db.NewTypedTable([]string{"x", "y"}, []db.Type{db.Int, db.Float}, true)
+	r.AddTuples([]db.Tuple{{int64(1), 2.0}, {int64(2), 2.5}, {int64(1), 3.0}})
+	d := db.Database{"r": r}
+	q, err := ParseSQL("SELECT r.y FROM r WHERE r.x = 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bound, _, err := q.Bind(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := bound["r"]; got.Size() != 2 || got.Types()[0] != db.Float {
+		t.Errorf("r is %v", got)
+	}
+	q, err = ParseSQL("SELECT r.y FROM r WHERE r.x = 'a'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := q.Bind(d); err == nil || !strings.Contains(err.Error(), "not a valid int") {
+		t.Errorf("bound a string to an int column: %v", err)
+	}
+}
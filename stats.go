@@ -0,0 +1,109 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cem-okulmus/BalancedGo/lib"
+	"github.com/dmlongo/hd-gen/db"
+	"github.com/dmlongo/hd-gen/decomp"
+)
+
+var statsCmd = command{
+	name:    "stats",
+	summary: "Print the statistics used to evaluate decompositions",
+	flags: func(flagSet *flag.FlagSet) {
+		flagSet.StringVar(&graph, "graph", "", "Hypergraph whose edges the statistics refer to (required by evaljoin)")
+		flagSet.StringVar(&evaldb, "evaldb", "", "Print the statistics of a given database")
+		csvFlags(flagSet)
+		flagSet.StringVar(&evaljoin, "evaljoin", "", "Print the statistics of given join estimates")
+		flagSet.IntVar(&width, "width", 1, "Print the statistics of combinations of up to width edges (requires graph)")
+	},
+	validate: func() error {
+		if err := validateCSV(); err != nil {
+			return err
+		}
+		if err := validateEvaluator(true); err != nil {
+			return err
+		}
+		if evaljoin != "" && graph == "" {
+			return fmt.Errorf("evaljoin requires graph")
+		}
+		if width <= 0 {
+			return fmt.Errorf("width must be > 0")
+		}
+		return nil
+	},
+	run: runStats,
+}
+
+func runStats() {
+	if graph == "" {
+		data := loadDB(evaldb)
+		var tNames []string
+		for tName := range data {
+			tNames = append(tNames, tName)
+		}
+		sort.Strings(tNames)
+		for _, tName := range tNames {
+			printStats(tName, data[tName].Stats, nil)
+		}
+		return
+	}
+
+	hg, parsedGraph := loadGraph(graph)
+	var sdb decomp.StatisticsDB
+	if evaldb != "" {
+		sdb = decomp.StatsFromDB(loadDB(evaldb), hg, parsedGraph.Encoding)
+	} else {
+		sdb = decomp.LoadStatistics(evaljoin, hg, parsedGraph.Encoding)
+	}
+	vNames := decomp.Names(parsedGraph.Encoding)
+	edges := hg.Edges.Slice()
+	for k := 1; k <= width && k <= len(edges); k++ {
+		forCombinations(len(edges), k, func(comb []int) {
+			var sel []lib.Edge
+			var eNames []string
+			for _, i := range comb {
+				sel = append(sel, edges[i])
+				eNames = append(eNames, vNames[edges[i].Name])
+			}
+			if st, ok := sdb.Stats(lib.NewEdges(sel)); ok {
+				printStats(strings.Join(eNames, ","), st, vNames)
+			}
+		})
+	}
+}
+
+// printStats translates the attributes named after encoded vertices if vNames is given
+func printStats(name string, st *db.Statistics, vNames map[int]string) {
+	fmt.Printf("%v: size %v\n", name, st.Size)
+	for i, attr := range st.Attributes() {
+		if v, err := strconv.Atoi(attr); err == nil && vNames != nil {
+			if vName, ok := vNames[v]; ok {
+				attr = vName
+			}
+		}
+		fmt.Printf("  %v\tndv %v\n", attr, st.Ndv[i])
+	}
+}
+
+// forCombinations calls f on every k-subset of {0, ..., n-1}
+func forCombinations(n int, k int, f func(comb []int)) {
+	comb := make([]int, k)
+	var rec func(pos int, from int)
+	rec = func(pos int, from int) {
+		if pos == k {
+			f(comb)
+			return
+		}
+		for i := from; i <= n-(k-pos); i++ {
+			comb[pos] = i
+			rec(pos+1, i+1)
+		}
+	}
+	rec(0, 0)
+}